@@ -0,0 +1,222 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/config"
+)
+
+// 默认重新扫描目录的间隔
+const defaultCatalogRescanInterval = 60 * time.Second
+
+// 目录扫描器
+var catalogs = newCatalogScanner()
+
+// catalogScanner 扫描目录发现缓存，保留每个目录上次的扫描结果，只重新扫描到期的目录
+type catalogScanner struct {
+	mu      sync.Mutex
+	scanned map[config.Catalog]catalogResult
+	invalid map[string]string // 无效缓存的路径及原因，原因不变时不重复输出日志
+}
+
+// catalogResult 目录的扫描结果
+type catalogResult struct {
+	time     time.Time
+	services []config.Service
+}
+
+// 创建目录扫描器
+func newCatalogScanner() *catalogScanner {
+	return &catalogScanner{
+		scanned: make(map[config.Catalog]catalogResult),
+		invalid: make(map[string]string),
+	}
+}
+
+// 扫描目录，返回发现的全部服务。force为false时只扫描到期的目录，其余使用上次的结果；
+// changed表示与上次相比是否有变化
+func (s *catalogScanner) scan(cs []config.Catalog, force bool) (services []config.Service, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	scanned := make(map[config.Catalog]catalogResult)
+	services = []config.Service{}
+	for _, c := range cs {
+		if _, ok := scanned[c]; ok {
+			continue
+		}
+		r, ok := s.scanned[c]
+		if force || !ok || isCatalogDue(c, r.time, now) {
+			found := s.scanCatalog(c, r.services)
+			if !ok || !equalServices(found, r.services) {
+				changed = true
+			}
+			r = catalogResult{time: now, services: found}
+		}
+		scanned[c] = r
+		services = append(services, r.services...)
+	}
+	if len(scanned) != len(s.scanned) {
+		changed = true
+	}
+	s.scanned = scanned
+	return services, changed
+}
+
+// 递归扫描一个目录，包含conf.xml的目录、MBTiles文件和切片包作为服务。previous为上次发现的服务，其中的缓存不再重复校验
+func (s *catalogScanner) scanCatalog(c config.Catalog, previous []config.Service) []config.Service {
+	valid := make(map[string]bool)
+	for _, p := range previous {
+		valid[p.Path] = true
+	}
+
+	services := []config.Service{}
+	add := func(path string) {
+		svc := newCatalogService(c, path)
+		if !valid[path] {
+			// 新发现的缓存先尝试打开，无效的缓存跳过
+			entry, err := openService(svc)
+			if err != nil {
+				if s.invalid[path] != err.Error() {
+					s.invalid[path] = err.Error()
+					log.Printf("跳过无效的缓存%s：%v", path, err)
+				}
+				return
+			}
+			entry.close()
+			delete(s.invalid, path)
+		}
+		services = append(services, svc)
+	}
+
+	err := filepath.Walk(c.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == c.Path {
+				return err
+			}
+			log.Printf("扫描目录%s出错：%v", path, err)
+			return nil
+		}
+		if info.IsDir() {
+			if path != c.Path && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "conf.xml")); err == nil {
+				add(path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isTileStoreFile(path) {
+			add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("扫描目录%s出错：%v", c.Path, err)
+	}
+	return services
+}
+
+// 是否为可直接发布的切片文件
+func isTileStoreFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mbtiles" || ext == ".vtpk" || ext == ".tpk" || ext == ".tpkx"
+}
+
+// 根据缓存在目录中的位置生成服务配置：最后一级为服务名，上级子目录以_连接作为文件夹。
+// ArcGIS Server缓存目录（xxx_MapServer/Layers）去掉Layers和_MapServer后缀
+func newCatalogService(c config.Catalog, path string) config.Service {
+	rel, err := filepath.Rel(c.Path, path)
+	if err != nil || rel == "." {
+		rel = filepath.Base(path)
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	last := len(segments) - 1
+	if isTileStoreFile(path) {
+		segments[last] = strings.TrimSuffix(segments[last], filepath.Ext(segments[last]))
+	}
+	if last > 0 && strings.EqualFold(segments[last], "Layers") {
+		segments = segments[:last]
+		last--
+	}
+	segments[last] = strings.TrimSuffix(segments[last], "_MapServer")
+
+	s := config.Service{
+		Name:        segments[last],
+		Folder:      strings.Join(segments[:last], "_"),
+		Path:        path,
+		MissingTile: c.MissingTile,
+		MaxAge:      c.MaxAge,
+	}
+	if c.Folder != "" {
+		s.Name = strings.Join(segments, "_")
+		s.Folder = c.Folder
+	}
+	return s
+}
+
+// 目录是否需要重新扫描
+func isCatalogDue(c config.Catalog, last time.Time, now time.Time) bool {
+	interval := time.Duration(c.RescanInterval) * time.Second
+	if c.RescanInterval == 0 {
+		interval = defaultCatalogRescanInterval
+	} else if c.RescanInterval < 0 {
+		return false
+	}
+	return now.Sub(last) >= interval
+}
+
+// 两次扫描结果是否相同
+func equalServices(a []config.Service, b []config.Service) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 合并配置文件中的服务和扫描发现的服务，服务名重复时以配置文件为准
+func mergeServices(configured []config.Service, discovered []config.Service) []config.Service {
+	names := make(map[string]bool)
+	services := make([]config.Service, 0, len(configured)+len(discovered))
+	for _, s := range configured {
+		names[s.QualifiedName()] = true
+		services = append(services, s)
+	}
+	for _, s := range discovered {
+		name := s.QualifiedName()
+		if names[name] {
+			log.Printf("服务%s已存在，跳过%s", name, s.Path)
+			continue
+		}
+		names[name] = true
+		services = append(services, s)
+	}
+	return services
+}
+
+// 加载配置文件中的服务和扫描发现的服务，force为true时重新扫描全部目录
+func loadServices(c config.Config, force bool) error {
+	services.setConfig(c)
+	discovered, _ := catalogs.scan(c.Catalogs, force)
+	return services.load(mergeServices(c.Services, discovered))
+}
+
+// 重新扫描到期的目录，有变化时重新加载服务
+func rescanCatalogs(c config.Config) {
+	discovered, changed := catalogs.scan(c.Catalogs, false)
+	if changed {
+		services.load(mergeServices(c.Services, discovered))
+	}
+}
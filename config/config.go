@@ -1,15 +1,93 @@
 package config
 
+// 缺失切片的处理方式
+const (
+	MissingTileNotFound    = "404"
+	MissingTileBlank       = "blank"
+	MissingTilePlaceholder = "placeholder"
+)
+
 type Config struct {
-	Server   Server
-	Services []Service
+	Server    Server    `toml:"server"`
+	Admin     Admin     `toml:"admin"`
+	TileCache TileCache `toml:"tileCache"`
+	Services  []Service `toml:"services"`
+	Catalogs  []Catalog `toml:"catalogs,omitempty"`
 }
 
 type Server struct {
-	Port int64
+	Port           int64 `toml:"port"`
+	MaxOpenBundles int   `toml:"maxOpenBundles,omitempty"` // 最多同时打开的bundle文件数，为0时使用默认值
+}
+
+type Admin struct {
+	Token string `toml:"token"` // 管理接口的访问令牌，为空时不启用管理接口
+}
+
+type TileCache struct {
+	MaxBytes int64 `toml:"maxBytes"` // 切片缓存容量（字节），为0时不缓存
 }
 
 type Service struct {
-	Name string
-	Path string
+	Folder           string   `toml:"folder,omitempty" json:"folder,omitempty"` // 所在文件夹，为空时位于根目录
+	Name             string   `toml:"name" json:"name"`
+	Path             string   `toml:"path" json:"path"`
+	MissingTile      string   `toml:"missingTile,omitempty" json:"missingTile,omitempty"`           // 缺失切片的处理方式：404（默认）、blank（透明PNG）、placeholder（占位图片）
+	PlaceholderImage string   `toml:"placeholderImage,omitempty" json:"placeholderImage,omitempty"` // 占位图片路径，MissingTile为placeholder时有效
+	DisableTileCache bool     `toml:"disableTileCache,omitempty" json:"disableTileCache,omitempty"` // 不使用切片缓存
+	CacheControl     string   `toml:"cacheControl,omitempty" json:"cacheControl,omitempty"`         // 切片的Cache-Control响应头，优先于MaxAge
+	MaxAge           int64    `toml:"maxAge,omitempty" json:"maxAge,omitempty"`                     // 切片的浏览器缓存时间（秒），输出public, max-age=MaxAge
+	Reproject        string   `toml:"reproject,omitempty" json:"reproject,omitempty"`               // 重投影的目标坐标系：3857（Web墨卡托）、bd09mc（百度墨卡托），为空时不重投影
+	DatumShift       string   `toml:"datumShift,omitempty" json:"datumShift,omitempty"`             // 坐标基准转换（纠偏）：wgs84-gcj02、gcj02-wgs84、wgs84-bd09、bd09-wgs84、gcj02-bd09、bd09-gcj02，目标为bd09时输出百度切片
+	Resampling       string   `toml:"resampling,omitempty" json:"resampling,omitempty"`             // 重投影的重采样方式：bilinear（默认）、nearest
+	Metadata         Metadata `toml:"metadata,omitempty" json:"metadata"`                           // 服务元数据，为空的字段使用切片缓存中的值
+}
+
+// QualifiedName 带文件夹的服务名，如folder/name
+func (s Service) QualifiedName() string {
+	if s.Folder == "" {
+		return s.Name
+	}
+	return s.Folder + "/" + s.Name
+}
+
+// Catalog 自动扫描发布缓存的目录
+type Catalog struct {
+	Path           string `toml:"path"`                     // 扫描的根目录
+	Folder         string `toml:"folder,omitempty"`         // 服务所在文件夹，为空时根据子目录确定
+	RescanInterval int64  `toml:"rescanInterval,omitempty"` // 重新扫描的间隔（秒），为0时默认为60，小于0时不重新扫描
+	MissingTile    string `toml:"missingTile,omitempty"`    // 发现的服务的缺失切片处理方式
+	MaxAge         int64  `toml:"maxAge,omitempty"`         // 发现的服务的切片浏览器缓存时间（秒）
+}
+
+// Metadata 服务元数据
+type Metadata struct {
+	Description   string       `toml:"description,omitempty" json:"description,omitempty"`
+	CopyrightText string       `toml:"copyrightText,omitempty" json:"copyrightText,omitempty"`
+	Capabilities  string       `toml:"capabilities,omitempty" json:"capabilities,omitempty"`
+	InitialExtent Extent       `toml:"initialExtent,omitempty" json:"initialExtent"` // 初始范围，坐标系与全图范围一致，全为0时使用全图范围
+	DocumentInfo  DocumentInfo `toml:"documentInfo,omitempty" json:"documentInfo"`
+}
+
+// Extent 矩形范围
+type Extent struct {
+	XMin float64 `toml:"xmin" json:"xmin"`
+	YMin float64 `toml:"ymin" json:"ymin"`
+	XMax float64 `toml:"xmax" json:"xmax"`
+	YMax float64 `toml:"ymax" json:"ymax"`
+}
+
+// IsEmpty 是否未设置范围
+func (e Extent) IsEmpty() bool {
+	return e == Extent{}
+}
+
+// DocumentInfo 文档信息
+type DocumentInfo struct {
+	Title    string `toml:"title,omitempty" json:"title,omitempty"`
+	Author   string `toml:"author,omitempty" json:"author,omitempty"`
+	Comments string `toml:"comments,omitempty" json:"comments,omitempty"`
+	Subject  string `toml:"subject,omitempty" json:"subject,omitempty"`
+	Category string `toml:"category,omitempty" json:"category,omitempty"`
+	Keywords string `toml:"keywords,omitempty" json:"keywords,omitempty"`
 }
@@ -2,16 +2,49 @@ package arcgisCache
 
 import (
 	"errors"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
 )
 
 var (
-	ErrUnsupportCacheVersion = errors.New("不支持的缓存版本")
-	ErrInvalidLevelRowCol    = errors.New("无效的级别、行、列")
+	ErrUnsupportCacheVersion  = errors.New("不支持的缓存版本")
+	ErrUnsupportStorageFormat = errors.New("不支持的缓存存储格式")
+	ErrInvalidLevelRowCol     = errors.New("无效的级别、行、列")
+	ErrLevelOutOfRange        = errors.New("级别超出范围")
+	ErrBundleNotFound         = errors.New("bundle文件不存在")
+	ErrTileNotFound           = errors.New("切片不存在")
+	ErrInvalidBundle          = errors.New("无效的bundle文件")
+	ErrInvalidPacketSize      = errors.New("无效的bundle行列数（PacketSize）")
+)
+
+// bundle行列数上限，ArcGIS默认为128，限制上限以免读取V2索引时分配过大的内存
+const maxPacketSize = 1024
+
+// 缓存存储格式
+const (
+	StorageFormatExploded  = "esriMapCacheStorageModeExploded"
+	StorageFormatCompact   = "esriMapCacheStorageModeCompact"
+	StorageFormatCompactV2 = "esriMapCacheStorageModeCompactV2"
 )
 
 // ArcgisCache ArcGIS缓存接口
 type ArcgisCache interface {
-	GetMapServerJSONString(pretty bool) (string, error)
+	GetMapServerJSONString(metadata Metadata, pretty bool) (string, error)
+	GetMetadata() Metadata
+	GetCacheInfo() conf.CacheInfo
+	GetEnvelope() conf.EnvelopeN
 	GetTileFormat() string
 	GetTileBytes(level int64, row int64, col int64) ([]byte, error)
+	GetTileModTime(level int64, row int64, col int64) (time.Time, error)
+	Close() error
+}
+
+// checkPacketSize 检查紧凑型缓存的bundle行列数，切片行列号计算和bundle索引读取都依赖该值
+func checkPacketSize(cacheInfo conf.CacheInfo) error {
+	packetSize := cacheInfo.CacheStorageInfo.PacketSize
+	if packetSize <= 0 || packetSize > maxPacketSize {
+		return ErrInvalidPacketSize
+	}
+	return nil
 }
@@ -2,8 +2,9 @@ package arcgisCache
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
 )
@@ -13,6 +14,8 @@ type ArcgisCache10_1 struct {
 	Path      string
 	CacheInfo conf.CacheInfo
 	Envelope  conf.EnvelopeN
+	Metadata  Metadata      // 切片包中iteminfo.xml的描述、版权等信息
+	pkg       *packageCache // 切片包，缓存为目录时为nil
 }
 
 // NewArcgisCache10_1 根据路径创建一个新的切片解析器
@@ -22,6 +25,9 @@ func NewArcgisCache10_1(path string) (ArcgisCache10_1, error) {
 	if err != nil {
 		return a, err
 	}
+	if err := checkPacketSize(cacheInfo); err != nil {
+		return a, err
+	}
 	a.CacheInfo = cacheInfo
 
 	envelope, err := getEnvelope(path)
@@ -33,13 +39,28 @@ func NewArcgisCache10_1(path string) (ArcgisCache10_1, error) {
 }
 
 // GetMapServerJSONString 获取MapServer的json字符串
-func (a *ArcgisCache10_1) GetMapServerJSONString(pretty bool) (string, error) {
-	return getMapServerJSONString(a.CacheInfo, a.Envelope, pretty)
+func (a *ArcgisCache10_1) GetMapServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	return getMapServerJSONString(a.CacheInfo, a.Envelope, MergeMetadata(metadata, a.Metadata), true, pretty)
+}
+
+// GetMetadata 获取缓存自带的元数据，ArcGIS缓存目录没有描述、版权等信息，切片包取自iteminfo.xml
+func (a *ArcgisCache10_1) GetMetadata() Metadata {
+	return a.Metadata
+}
+
+// GetCacheInfo 获取切片配置信息
+func (a *ArcgisCache10_1) GetCacheInfo() conf.CacheInfo {
+	return a.CacheInfo
+}
+
+// GetEnvelope 获取范围
+func (a *ArcgisCache10_1) GetEnvelope() conf.EnvelopeN {
+	return a.Envelope
 }
 
-// GetTileFormat 获取瓦片格式
+// GetTileFormat 获取瓦片格式：png、jpeg等
 func (a *ArcgisCache10_1) GetTileFormat() string {
-	return strings.ToLower(a.CacheInfo.TileImageInfo.CacheTileFormat)
+	return NormalizeTileFormat(a.CacheInfo.TileImageInfo.CacheTileFormat)
 }
 
 // GetTileBytes 根据行列号获取切片
@@ -48,19 +69,61 @@ func (a *ArcgisCache10_1) GetTileBytes(level int64, row int64, col int64) ([]byt
 	if err != nil {
 		return nil, err
 	}
-	imageOffset, err := a.getImageOffset(bundleFilePath, recordNumber)
+	b, err := a.getBundle(bundleFilePath)
 	if err != nil {
 		return nil, err
 	}
-	imageData, err := a.getImageData(bundleFilePath, imageOffset)
+	defer bundles.release(b)
+
+	imageOffset, err := a.getImageOffset(b, recordNumber)
+	if err != nil {
+		return nil, err
+	}
+	imageData, err := a.getImageData(b, imageOffset)
 	if err != nil {
 		return nil, err
 	}
 	return imageData, nil
 }
 
+// GetTileModTime 获取切片所在bundle文件的修改时间
+func (a *ArcgisCache10_1) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	bundleFilePath, _, err := a.getTileInfo(level, row, col)
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := a.getBundle(bundleFilePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer bundles.release(b)
+	return b.modTime, nil
+}
+
+// GetTileMap 根据bundlx索引获取范围内切片是否存在
+func (a *ArcgisCache10_1) GetTileMap(level int64, row int64, col int64, width int64, height int64) ([]int, error) {
+	return getBundleTileMap(level, row, col, width, height, a.getTileInfo, a.getBundle, a.hasTile)
+}
+
+// Close 关闭缓存
+func (a *ArcgisCache10_1) Close() error {
+	// 切片包关闭时移除其中的bundle
+	if a.pkg != nil {
+		return a.pkg.Close()
+	}
+	bundles.purge(a.Path + "/")
+	return nil
+}
+
 // 根据级别、行、列号获取切片信息
 func (a *ArcgisCache10_1) getTileInfo(level int64, row int64, col int64) (string, int64, error) {
+	if !hasLevel(a.CacheInfo, level) {
+		return "", 0, ErrLevelOutOfRange
+	}
+	if row < 0 || col < 0 {
+		return "", 0, ErrInvalidLevelRowCol
+	}
+
 	packetSize := a.CacheInfo.CacheStorageInfo.PacketSize
 	basePath := a.Path
 	rowIndex := (row / packetSize) * packetSize
@@ -71,71 +134,114 @@ func (a *ArcgisCache10_1) getTileInfo(level int64, row int64, col int64) (string
 
 	// 切片顺序号
 	recordNumber := packetSize*(col-colIndex) + (row - rowIndex)
-	if recordNumber < 0 {
-		return "", 0, ErrInvalidLevelRowCol
-	}
 
 	return filepath, recordNumber, nil
 }
 
-// 获取切片数据在bundle中的偏移量
-func (a *ArcgisCache10_1) getImageOffset(bundleFilePath string, recordNumber int64) (int64, error) {
-	var result int64
+// 从bundle文件池获取bundle，使用完毕后需调用bundles.release。
+// 切片包中的bundle读取的是本实例打开的包，以包实例区分键
+func (a *ArcgisCache10_1) getBundle(bundleFilePath string) (*bundle, error) {
+	key := bundleFilePath
+	if a.pkg != nil {
+		key = a.pkg.bundleKey(bundleFilePath)
+	}
+	return bundles.get(key, func() (*bundle, error) {
+		return a.openBundle(bundleFilePath)
+	})
+}
 
-	// 打开bundlx文件
-	f, err := os.Open(fmt.Sprintf(`%s.bundlx`, bundleFilePath))
+// 打开bundle文件，并一次性读取bundlx索引
+func (a *ArcgisCache10_1) openBundle(bundleFilePath string) (*bundle, error) {
+	if a.pkg != nil {
+		return a.openPackageBundle(bundleFilePath)
+	}
+
+	// bundlx：16字节头 + 81920字节（128 × 128 × 5）偏移量信息 + 16字节尾
+	index, err := ioutil.ReadFile(fmt.Sprintf(`%s.bundlx`, bundleFilePath))
+	if os.IsNotExist(err) {
+		return nil, ErrBundleNotFound
+	}
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	defer f.Close()
 
-	// bundlex：16字节头 + 81920字节（128 × 128 × 5）偏移量信息 + 16字节尾
-	// 偏移tileOffset，找到记录切片位置的索引
-	tileOffset := 16 + (recordNumber * 5)
-	_, err = f.Seek(tileOffset, 0)
+	f, err := openBundleFile(fmt.Sprintf(`%s.bundle`, bundleFilePath))
 	if err != nil {
-		return result, err
+		return nil, err
 	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &bundle{file: f, index: index, path: f.Name(), size: info.Size(), modTime: info.ModTime()}, nil
+}
 
-	// 读取5个字节，并转为int64，即为切片在bundle中的偏移量
-	bytes := make([]byte, 5)
-	_, err = f.Read(bytes)
+// 打开切片包中的bundle文件，并一次性读取bundlx索引
+func (a *ArcgisCache10_1) openPackageBundle(bundleFilePath string) (*bundle, error) {
+	index, err := a.pkg.readFile(bundleFilePath + ".bundlx")
 	if err != nil {
-		return result, err
+		return nil, err
+	}
+	f, info, err := a.pkg.openFile(bundleFilePath + ".bundle")
+	if err != nil {
+		return nil, err
+	}
+	return &bundle{file: f, index: index, size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// 获取切片数据在bundle中的偏移量
+func (a *ArcgisCache10_1) getImageOffset(b *bundle, recordNumber int64) (int64, error) {
+	// 偏移tileOffset，找到记录切片位置的索引
+	tileOffset := 16 + (recordNumber * 5)
+	if tileOffset+5 > int64(len(b.index)) {
+		return 0, ErrInvalidBundle
 	}
-	imageOffset := bytesToInt64(bytes)
+
+	// 读取5个字节，并转为int64，即为切片在bundle中的偏移量
+	imageOffset := bytesToInt64(b.index[tileOffset : tileOffset+5])
 
 	return imageOffset, nil
 }
 
+// 切片是否存在，空切片的数据长度为0
+func (a *ArcgisCache10_1) hasTile(b *bundle, recordNumber int64) (bool, error) {
+	imageOffset, err := a.getImageOffset(b, recordNumber)
+	if err != nil {
+		return false, err
+	}
+	bytes := make([]byte, 4)
+	if _, err := b.file.ReadAt(bytes, imageOffset); err != nil {
+		return false, err
+	}
+	return bytesToInt64(bytes) > 0, nil
+}
+
 // 获取切片数据
-func (a *ArcgisCache10_1) getImageData(bundleFilePath string, imageOffset int64) ([]byte, error) {
+func (a *ArcgisCache10_1) getImageData(b *bundle, imageOffset int64) ([]byte, error) {
 	var result []byte
 
-	// 打开bundle文件
-	f, err := os.Open(fmt.Sprintf(`%s.bundle`, bundleFilePath))
+	// 偏移imageOffset，读取4个字节，并转为int64，即为切片数据长度
+	bytes := make([]byte, 4)
+	_, err := b.file.ReadAt(bytes, imageOffset)
 	if err != nil {
 		return result, err
 	}
-	defer f.Close()
+	imageLength := bytesToInt64(bytes)
 
-	// 偏移imageOffset，找到切片位置索引
-	f.Seek(imageOffset, 0)
-	if err != nil {
-		return result, err
+	// 空切片在bundle头部有长度为0的占位记录
+	if imageLength == 0 {
+		return result, ErrTileNotFound
 	}
 
-	// 读取4个字节，并转为int64，即为切片数据长度
-	bytes := make([]byte, 4)
-	_, err = f.Read(bytes)
-	if err != nil {
-		return result, err
+	// 长度超出bundle文件时bundle已损坏，不按其分配内存
+	if imageLength < 0 || imageOffset+4+imageLength > b.size {
+		return result, ErrInvalidBundle
 	}
-	imageLength := bytesToInt64(bytes)
 
 	// 读取imageLength字节，即为切片数据
 	imageData := make([]byte, imageLength)
-	f.Read(imageData)
+	_, err = b.file.ReadAt(imageData, imageOffset+4)
 	if err != nil {
 		return result, err
 	}
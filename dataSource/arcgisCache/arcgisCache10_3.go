@@ -3,7 +3,7 @@ package arcgisCache
 import (
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
 )
@@ -13,6 +13,8 @@ type ArcgisCache10_3 struct {
 	Path      string
 	CacheInfo conf.CacheInfo
 	Envelope  conf.EnvelopeN
+	Metadata  Metadata      // 切片包中iteminfo.xml的描述、版权等信息
+	pkg       *packageCache // 切片包，缓存为目录时为nil
 }
 
 // NewArcgisCache10_3 根据路径创建一个新的切片解析器
@@ -22,6 +24,9 @@ func NewArcgisCache10_3(path string) (ArcgisCache10_3, error) {
 	if err != nil {
 		return a, err
 	}
+	if err := checkPacketSize(cacheInfo); err != nil {
+		return a, err
+	}
 	a.CacheInfo = cacheInfo
 
 	envelope, err := getEnvelope(path)
@@ -33,13 +38,28 @@ func NewArcgisCache10_3(path string) (ArcgisCache10_3, error) {
 }
 
 // GetMapServerJSONString 获取MapServer的json字符串
-func (a *ArcgisCache10_3) GetMapServerJSONString(pretty bool) (string, error) {
-	return getMapServerJSONString(a.CacheInfo, a.Envelope, pretty)
+func (a *ArcgisCache10_3) GetMapServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	return getMapServerJSONString(a.CacheInfo, a.Envelope, MergeMetadata(metadata, a.Metadata), true, pretty)
+}
+
+// GetMetadata 获取缓存自带的元数据，ArcGIS缓存目录没有描述、版权等信息，切片包取自iteminfo.xml
+func (a *ArcgisCache10_3) GetMetadata() Metadata {
+	return a.Metadata
+}
+
+// GetCacheInfo 获取切片配置信息
+func (a *ArcgisCache10_3) GetCacheInfo() conf.CacheInfo {
+	return a.CacheInfo
+}
+
+// GetEnvelope 获取范围
+func (a *ArcgisCache10_3) GetEnvelope() conf.EnvelopeN {
+	return a.Envelope
 }
 
-// GetTileFormat 获取瓦片格式
+// GetTileFormat 获取瓦片格式：png、jpeg等
 func (a *ArcgisCache10_3) GetTileFormat() string {
-	return strings.ToLower(a.CacheInfo.TileImageInfo.CacheTileFormat)
+	return NormalizeTileFormat(a.CacheInfo.TileImageInfo.CacheTileFormat)
 }
 
 // GetTileBytes 根据行列号获取切片
@@ -48,15 +68,57 @@ func (a *ArcgisCache10_3) GetTileBytes(level int64, row int64, col int64) ([]byt
 	if err != nil {
 		return nil, err
 	}
-	imageData, err := a.getImageData(bundleFilePath, recordNumber)
+	b, err := a.getBundle(bundleFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundles.release(b)
+
+	imageData, err := getCompactV2ImageData(b, recordNumber)
 	if err != nil {
 		return nil, err
 	}
 	return imageData, nil
 }
 
+// GetTileModTime 获取切片所在bundle文件的修改时间
+func (a *ArcgisCache10_3) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	bundleFilePath, _, err := a.getTileInfo(level, row, col)
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := a.getBundle(bundleFilePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer bundles.release(b)
+	return b.modTime, nil
+}
+
+// GetTileMap 根据bundle头部索引获取范围内切片是否存在
+func (a *ArcgisCache10_3) GetTileMap(level int64, row int64, col int64, width int64, height int64) ([]int, error) {
+	return getBundleTileMap(level, row, col, width, height, a.getTileInfo, a.getBundle, hasCompactV2Tile)
+}
+
+// Close 关闭缓存
+func (a *ArcgisCache10_3) Close() error {
+	// 切片包关闭时移除其中的bundle
+	if a.pkg != nil {
+		return a.pkg.Close()
+	}
+	bundles.purge(a.Path + "/")
+	return nil
+}
+
 // 根据级别、行、列号获取切片信息
 func (a *ArcgisCache10_3) getTileInfo(level int64, row int64, col int64) (string, int64, error) {
+	if !hasLevel(a.CacheInfo, level) {
+		return "", 0, ErrLevelOutOfRange
+	}
+	if row < 0 || col < 0 {
+		return "", 0, ErrInvalidLevelRowCol
+	}
+
 	packetSize := a.CacheInfo.CacheStorageInfo.PacketSize
 	basePath := a.Path
 	rowIndex := (row / packetSize) * packetSize
@@ -67,56 +129,98 @@ func (a *ArcgisCache10_3) getTileInfo(level int64, row int64, col int64) (string
 
 	// 切片顺序号
 	recordNumber := packetSize*(row-rowIndex) + (col - colIndex)
-	if recordNumber < 0 {
-		return "", 0, ErrInvalidLevelRowCol
-	}
 
 	return filepath, recordNumber, nil
 }
 
-// 获取切片数据（bundleFilePath：文件路径，recordNumber：切片顺序号）
-func (a *ArcgisCache10_3) getImageData(bundleFilePath string, recordNumber int64) ([]byte, error) {
-	var result []byte
+// 从bundle文件池获取bundle，使用完毕后需调用bundles.release。
+// 切片包中的bundle读取的是本实例打开的包，以包实例区分键
+func (a *ArcgisCache10_3) getBundle(bundleFilePath string) (*bundle, error) {
+	key := bundleFilePath
+	if a.pkg != nil {
+		key = a.pkg.bundleKey(bundleFilePath)
+	}
+	return bundles.get(key, func() (*bundle, error) {
+		return a.openBundle(bundleFilePath)
+	})
+}
 
-	// 打开bundle文件
-	f, err := os.Open(fmt.Sprintf(`%s.bundle`, bundleFilePath))
-	if err != nil {
-		return result, err
+// 打开bundle文件，并一次性读取头部的切片索引
+func (a *ArcgisCache10_3) openBundle(bundleFilePath string) (*bundle, error) {
+	if a.pkg != nil {
+		f, info, err := a.pkg.openFile(bundleFilePath + ".bundle")
+		if err != nil {
+			return nil, err
+		}
+		return readCompactV2Bundle(f, a.CacheInfo.CacheStorageInfo.PacketSize, info)
 	}
-	defer f.Close()
 
-	// 偏移tileOffset，找到切片位置索引
-	tileOffset := 64 + (recordNumber * 8)
-	_, err = f.Seek(tileOffset, 0)
+	f, err := openBundleFile(fmt.Sprintf(`%s.bundle`, bundleFilePath))
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-
-	// 读取4个字节，并转为int64，即为切片位置偏移量
-	bytes := make([]byte, 4)
-	_, err = f.Read(bytes)
+	info, err := f.Stat()
 	if err != nil {
-		return result, err
+		f.Close()
+		return nil, err
 	}
-	imageOffset := bytesToInt64(bytes)
-
-	// 偏移imageOffset-4，找到切片数据长度索引
-	f.Seek(imageOffset-4, 0)
+	b, err := readCompactV2Bundle(f, a.CacheInfo.CacheStorageInfo.PacketSize, info)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
+	b.path = f.Name()
+	return b, nil
+}
 
-	// 读取4个字节，并转为int64，即为切片数据长度
-	bytes = make([]byte, 4)
-	_, err = f.Read(bytes)
+// 读取紧凑型V2（10.3及以后）bundle头部的切片索引，出错时关闭文件
+func readCompactV2Bundle(f bundleReader, packetSize int64, info os.FileInfo) (*bundle, error) {
+	// bundle：64字节头 + 131072字节（128 × 128 × 8）索引 + 切片数据
+	index := make([]byte, packetSize*packetSize*8)
+	_, err := f.ReadAt(index, 64)
 	if err != nil {
-		return result, err
+		f.Close()
+		return nil, err
+	}
+	return &bundle{file: f, index: index, size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// 切片是否存在，索引中切片数据长度为0时不存在
+func hasCompactV2Tile(b *bundle, recordNumber int64) (bool, error) {
+	tileOffset := recordNumber * 8
+	if tileOffset+8 > int64(len(b.index)) {
+		return false, ErrInvalidBundle
+	}
+	return bytesToInt64(b.index[tileOffset+5:tileOffset+8]) > 0, nil
+}
+
+// 获取紧凑型V2 bundle中的切片数据（b：bundle文件，recordNumber：切片顺序号）
+func getCompactV2ImageData(b *bundle, recordNumber int64) ([]byte, error) {
+	var result []byte
+
+	// 偏移tileOffset，找到切片位置索引
+	tileOffset := recordNumber * 8
+	if tileOffset+8 > int64(len(b.index)) {
+		return result, ErrInvalidBundle
+	}
+
+	// 读取8个字节：低5个字节为切片位置偏移量，高3个字节为切片数据长度
+	bytes := b.index[tileOffset : tileOffset+8]
+	imageOffset := bytesToInt64(bytes[:5])
+	imageLength := bytesToInt64(bytes[5:])
+
+	// 空切片的长度为0
+	if imageLength == 0 {
+		return result, ErrTileNotFound
+	}
+
+	// 超出bundle文件时bundle已损坏
+	if imageOffset+imageLength > b.size {
+		return result, ErrInvalidBundle
 	}
-	imageLength := bytesToInt64(bytes)
 
 	// 读取imageLength字节，即为切片数据
 	imageData := make([]byte, imageLength)
-	f.Read(imageData)
+	_, err := b.file.ReadAt(imageData, imageOffset)
 	if err != nil {
 		return result, err
 	}
@@ -0,0 +1,132 @@
+package arcgisCache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// ArcgisCacheExploded ArcGIS松散型缓存
+type ArcgisCacheExploded struct {
+	Path      string
+	CacheInfo conf.CacheInfo
+	Envelope  conf.EnvelopeN
+}
+
+// NewArcgisCacheExploded 根据路径创建一个新的切片解析器
+func NewArcgisCacheExploded(path string) (ArcgisCacheExploded, error) {
+	a := ArcgisCacheExploded{Path: path}
+	cacheInfo, err := getCacheInfo(path)
+	if err != nil {
+		return a, err
+	}
+	a.CacheInfo = cacheInfo
+
+	envelope, err := getEnvelope(path)
+	if err != nil {
+		return a, err
+	}
+	a.Envelope = envelope
+	return a, nil
+}
+
+// GetMapServerJSONString 获取MapServer的json字符串
+func (a *ArcgisCacheExploded) GetMapServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	return getMapServerJSONString(a.CacheInfo, a.Envelope, metadata, false, pretty)
+}
+
+// GetMetadata 获取缓存自带的元数据，ArcGIS缓存没有描述、版权等信息
+func (a *ArcgisCacheExploded) GetMetadata() Metadata {
+	return Metadata{}
+}
+
+// GetCacheInfo 获取切片配置信息
+func (a *ArcgisCacheExploded) GetCacheInfo() conf.CacheInfo {
+	return a.CacheInfo
+}
+
+// GetEnvelope 获取范围
+func (a *ArcgisCacheExploded) GetEnvelope() conf.EnvelopeN {
+	return a.Envelope
+}
+
+// GetTileFormat 获取瓦片格式：png、jpeg等
+func (a *ArcgisCacheExploded) GetTileFormat() string {
+	return NormalizeTileFormat(a.CacheInfo.TileImageInfo.CacheTileFormat)
+}
+
+// GetTileBytes 根据行列号获取切片
+func (a *ArcgisCacheExploded) GetTileBytes(level int64, row int64, col int64) ([]byte, error) {
+	tileFilePath, _, err := a.findTileFile(level, row, col)
+	if err != nil {
+		return nil, err
+	}
+	imageData, err := ioutil.ReadFile(tileFilePath)
+	if os.IsNotExist(err) {
+		return nil, ErrTileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imageData, nil
+}
+
+// GetTileModTime 获取切片文件的修改时间
+func (a *ArcgisCacheExploded) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	_, info, err := a.findTileFile(level, row, col)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Close 关闭缓存
+func (a *ArcgisCacheExploded) Close() error {
+	return nil
+}
+
+// 查找切片文件
+func (a *ArcgisCacheExploded) findTileFile(level int64, row int64, col int64) (string, os.FileInfo, error) {
+	if !hasLevel(a.CacheInfo, level) {
+		return "", nil, ErrLevelOutOfRange
+	}
+	if row < 0 || col < 0 {
+		return "", nil, ErrInvalidLevelRowCol
+	}
+
+	// L：2位十进制；R：8位十六进制；C：8位十六进制
+	basePath := fmt.Sprintf(`%s/_alllayers/L%02d/R%08x/C%08x`, a.Path, level, row, col)
+
+	// 混合格式的缓存中同时存在png和jpg，依次尝试
+	for _, suffix := range a.getTileSuffixes() {
+		tileFilePath := basePath + "." + suffix
+		info, err := os.Stat(tileFilePath)
+		if err == nil {
+			if info.Size() == 0 {
+				return "", nil, ErrTileNotFound
+			}
+			return tileFilePath, info, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+	return "", nil, ErrTileNotFound
+}
+
+// 获取切片文件可能的扩展名
+func (a *ArcgisCacheExploded) getTileSuffixes() []string {
+	format := strings.ToLower(a.CacheInfo.TileImageInfo.CacheTileFormat)
+	switch {
+	case strings.HasPrefix(format, "png"):
+		return []string{"png"}
+	case format == "jpeg" || format == "jpg":
+		return []string{"jpg"}
+	default:
+		return []string{"png", "jpg"}
+	}
+}
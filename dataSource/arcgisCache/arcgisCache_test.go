@@ -0,0 +1,62 @@
+package arcgisCache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// 在临时目录中生成只有一个级别的conf.xml和conf.cdi，返回缓存目录
+func writeTestCacheDir(t *testing.T, storageFormat string, packetSize string) string {
+	dir := t.TempDir()
+	storageInfo := fmt.Sprintf("<StorageFormat>%s</StorageFormat>", storageFormat)
+	if packetSize != "" {
+		storageInfo += fmt.Sprintf("<PacketSize>%s</PacketSize>", packetSize)
+	}
+	confXML := `<CacheInfo><TileCacheInfo><SpatialReference><WKID>4326</WKID><LatestWKID>4326</LatestWKID></SpatialReference>` +
+		`<TileOrigin><X>-180</X><Y>90</Y></TileOrigin><TileCols>256</TileCols><TileRows>256</TileRows><DPI>96</DPI>` +
+		`<LODInfos><LODInfo><LevelID>0</LevelID><Scale>295497593.05875</Scale><Resolution>0.703125</Resolution></LODInfo></LODInfos></TileCacheInfo>` +
+		`<TileImageInfo><CacheTileFormat>PNG</CacheTileFormat></TileImageInfo>` +
+		`<CacheStorageInfo>` + storageInfo + `</CacheStorageInfo></CacheInfo>`
+	confCDI := `<EnvelopeN><XMin>-180</XMin><YMin>-90</YMin><XMax>180</XMax><YMax>90</YMax></EnvelopeN>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf.xml"), []byte(confXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf.cdi"), []byte(confCDI), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCheckPacketSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		packetSize string
+		err        error
+	}{
+		{"默认128", "128", nil},
+		{"上限", "1024", nil},
+		{"没有PacketSize", "", ErrInvalidPacketSize},
+		{"为0", "0", ErrInvalidPacketSize},
+		{"为负数", "-128", ErrInvalidPacketSize},
+		{"超过上限", "65536", ErrInvalidPacketSize},
+	}
+	for _, tt := range tests {
+		_, err := NewArcgisCache10_1(writeTestCacheDir(t, StorageFormatCompact, tt.packetSize))
+		if err != tt.err {
+			t.Errorf("10.1缓存%s：错误为%v，期望%v", tt.name, err, tt.err)
+		}
+		_, err = NewArcgisCache10_3(writeTestCacheDir(t, StorageFormatCompactV2, tt.packetSize))
+		if err != tt.err {
+			t.Errorf("10.3缓存%s：错误为%v，期望%v", tt.name, err, tt.err)
+		}
+	}
+
+	// tpkx中packetSize超过上限
+	root := `{"storageInfo": {"packetSize": 65536}, "tileInfo": {"rows": 256, "cols": 256, "origin": {"x": -180, "y": 90},
+		"spatialReference": {"wkid": 4326}, "lods": [{"level": 0, "resolution": 0.703125, "scale": 295497593.05875}]}}`
+	if _, err := NewTilePackage(writeTestPackage(t, "packetSize.tpkx", map[string]string{"root.json": root})); err != ErrInvalidPacketSize {
+		t.Errorf("tpkx的packetSize超过上限时错误为%v，期望%v", err, ErrInvalidPacketSize)
+	}
+}
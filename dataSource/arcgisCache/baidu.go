@@ -0,0 +1,61 @@
+package arcgisCache
+
+import (
+	"math"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// 百度切片方案参数：百度墨卡托坐标，z级分辨率为2^(18-z)米/像素，切片号以(0,0)为原点、y轴向上。
+// 转为ArcGIS切片方案时以(-2^25, 2^25)为原点
+const (
+	baiduHalfSize = 33554432
+	baiduTileSize = 256
+	baiduMaxZoom  = 21
+)
+
+// BaiduMercatorWKT 百度墨卡托坐标系，没有WKID
+const BaiduMercatorWKT = `PROJCS["BD09_Baidu_Mercator",GEOGCS["GCS_BD09",DATUM["D_BD09",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Baidu_Mercator"],UNIT["Meter",1.0]]`
+
+// IsBaiduMercator 是否为百度墨卡托坐标系
+func IsBaiduMercator(sr conf.SpatialReference) bool {
+	return sr.WKT == BaiduMercatorWKT
+}
+
+// BaiduTileToLevelRowCol 百度切片号转为缓存的级别、行、列号，z至少为1
+func BaiduTileToLevelRowCol(z int64, x int64, y int64) (int64, int64, int64) {
+	half := int64(1) << uint(z-1)
+	return z, half - 1 - y, x + half
+}
+
+// 生成百度切片方案的切片配置信息，级别号与百度级别一致
+func newBaiduCacheInfo(minZoom int64, maxZoom int64, format string) conf.CacheInfo {
+	lodInfos := []conf.LODInfo{}
+	for z := minZoom; z <= maxZoom; z++ {
+		resolution := math.Pow(2, float64(18-z))
+		lodInfos = append(lodInfos, conf.LODInfo{
+			LevelID:    z,
+			Scale:      resolution * 96 / 0.0254,
+			Resolution: resolution,
+		})
+	}
+	return conf.CacheInfo{
+		TileCacheInfo: conf.TileCacheInfo{
+			SpatialReference: conf.SpatialReference{
+				WKT: BaiduMercatorWKT,
+			},
+			TileOrigin: conf.TileOrigin{
+				X: -baiduHalfSize,
+				Y: baiduHalfSize,
+			},
+			TileCols:   baiduTileSize,
+			TileRows:   baiduTileSize,
+			DPI:        96,
+			PreciseDPI: 96,
+			LODInfos:   lodInfos,
+		},
+		TileImageInfo: conf.TileImageInfo{
+			CacheTileFormat: format,
+		},
+	}
+}
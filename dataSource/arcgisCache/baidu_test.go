@@ -0,0 +1,49 @@
+package arcgisCache
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBaiduTileToLevelRowCol(t *testing.T) {
+	tests := []struct {
+		z, x, y         int64
+		level, row, col int64
+	}{
+		// 1级为2×2个切片，百度切片号以(0,0)为原点、y轴向上
+		{1, 0, 0, 1, 0, 1},
+		{1, -1, 0, 1, 0, 0},
+		{1, 0, -1, 1, 1, 1},
+		{1, -1, -1, 1, 1, 0},
+		// 18级天安门所在切片
+		{18, 50617, 18851, 18, 112220, 181689},
+		{18, -1, -1, 18, 131072, 131071},
+	}
+	for _, tt := range tests {
+		level, row, col := BaiduTileToLevelRowCol(tt.z, tt.x, tt.y)
+		if level != tt.level || row != tt.row || col != tt.col {
+			t.Errorf("BaiduTileToLevelRowCol(%d, %d, %d) = (%d, %d, %d)，期望(%d, %d, %d)",
+				tt.z, tt.x, tt.y, level, row, col, tt.level, tt.row, tt.col)
+		}
+	}
+}
+
+// 百度切片号转换后的行列号与百度切片方案下由坐标计算的行列号一致
+func TestBaiduTileMatchesCacheInfo(t *testing.T) {
+	cacheInfo := newBaiduCacheInfo(1, 18, "PNG")
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	x, y := BD09ToBaiduMercator(116.404, 39.915)
+	for _, lodInfo := range tileCacheInfo.LODInfos {
+		z := lodInfo.LevelID
+		tileSize := lodInfo.Resolution * float64(tileCacheInfo.TileCols)
+		baiduX := int64(math.Floor(x / tileSize))
+		baiduY := int64(math.Floor(y / tileSize))
+
+		level, row, col := BaiduTileToLevelRowCol(z, baiduX, baiduY)
+		wantRow := int64(math.Floor((tileCacheInfo.TileOrigin.Y - y) / tileSize))
+		wantCol := int64(math.Floor((x - tileCacheInfo.TileOrigin.X) / tileSize))
+		if level != z || row != wantRow || col != wantCol {
+			t.Errorf("%d级百度切片(%d, %d)转为(%d, %d, %d)，期望(%d, %d, %d)", z, baiduX, baiduY, level, row, col, z, wantRow, wantCol)
+		}
+	}
+}
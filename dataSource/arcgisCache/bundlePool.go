@@ -0,0 +1,163 @@
+package arcgisCache
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认最多同时打开的bundle文件数
+const defaultMaxOpenBundles = 256
+
+// 检查磁盘上的bundle文件是否被改写的间隔
+const bundleCheckInterval = 2 * time.Second
+
+// 全局bundle文件池
+var bundles = newBundlePool(defaultMaxOpenBundles)
+
+// SetMaxOpenBundles 设置最多同时打开的bundle文件数，小于等于0时使用默认值
+func SetMaxOpenBundles(maxOpen int) {
+	if maxOpen <= 0 {
+		maxOpen = defaultMaxOpenBundles
+	}
+	bundles.setMaxOpen(maxOpen)
+}
+
+// bundleReader bundle文件，可为磁盘上的文件或切片包中未压缩的文件
+type bundleReader interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// bundle 已打开的bundle文件及一次性读入内存的索引
+type bundle struct {
+	key     string
+	file    bundleReader
+	index   []byte
+	path    string    // 磁盘上的bundle文件路径，切片包中的bundle为空
+	size    int64     // bundle文件大小
+	modTime time.Time // bundle文件修改时间
+
+	refs    int       // 正在读取的请求数，由bundlePool.mu保护
+	evicted bool      // 是否已从池中移除，由bundlePool.mu保护
+	checked time.Time // 最近一次检查文件是否被改写的时间，由bundlePool.mu保护
+}
+
+// 磁盘上的bundle文件打开后是否被改写（修改时间或大小变化、被删除），每隔bundleCheckInterval检查一次。
+// 缓存原地更新后，已读入内存的索引不再有效
+func (b *bundle) modified() bool {
+	if b.path == "" || time.Since(b.checked) < bundleCheckInterval {
+		return false
+	}
+	b.checked = time.Now()
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return true
+	}
+	return info.Size() != b.size || !info.ModTime().Equal(b.modTime)
+}
+
+// bundlePool 按LRU保持最近使用的bundle文件处于打开状态，限制文件句柄数量。
+// 切片数据通过ReadAt读取，多个请求可并发读取同一个文件
+type bundlePool struct {
+	mu      sync.Mutex
+	maxOpen int
+	ll      *list.List
+	items   map[string]*list.Element
+}
+
+func newBundlePool(maxOpen int) *bundlePool {
+	return &bundlePool{
+		maxOpen: maxOpen,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// 获取bundle，不在池中或文件已被改写时调用open打开，使用完毕后需调用release
+func (p *bundlePool) get(key string, open func() (*bundle, error)) (*bundle, error) {
+	p.mu.Lock()
+	if e, ok := p.items[key]; ok {
+		b := e.Value.(*bundle)
+		if !b.modified() {
+			p.ll.MoveToFront(e)
+			b.refs++
+			p.mu.Unlock()
+			return b, nil
+		}
+		p.remove(e)
+	}
+	p.mu.Unlock()
+
+	// 打开文件时不持有锁
+	b, err := open()
+	if err != nil {
+		return nil, err
+	}
+	b.key = key
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 其他请求已打开同一个文件
+	if e, ok := p.items[key]; ok {
+		b.file.Close()
+		p.ll.MoveToFront(e)
+		b = e.Value.(*bundle)
+		b.refs++
+		return b, nil
+	}
+	b.refs++
+	b.checked = time.Now()
+	p.items[key] = p.ll.PushFront(b)
+	p.evict()
+	return b, nil
+}
+
+// 释放bundle，已移除且没有请求在读取时关闭文件
+func (p *bundlePool) release(b *bundle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.refs--
+	if b.evicted && b.refs == 0 {
+		b.file.Close()
+	}
+}
+
+// 移除路径前缀为prefix的bundle，缓存关闭时调用
+func (p *bundlePool) purge(prefix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for e := p.ll.Front(); e != nil; {
+		next := e.Next()
+		if strings.HasPrefix(e.Value.(*bundle).key, prefix) {
+			p.remove(e)
+		}
+		e = next
+	}
+}
+
+func (p *bundlePool) setMaxOpen(maxOpen int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxOpen = maxOpen
+	p.evict()
+}
+
+// 关闭最久未使用的文件直到不超出数量限制
+func (p *bundlePool) evict() {
+	for p.ll.Len() > p.maxOpen {
+		p.remove(p.ll.Back())
+	}
+}
+
+func (p *bundlePool) remove(e *list.Element) {
+	b := p.ll.Remove(e).(*bundle)
+	delete(p.items, b.key)
+	b.evicted = true
+	if b.refs == 0 {
+		b.file.Close()
+	}
+}
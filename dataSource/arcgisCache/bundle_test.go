@@ -0,0 +1,268 @@
+package arcgisCache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试用bundle的行列数，使bundle索引足够小
+const testPacketSize = 4
+
+// 将value按从低位到高位的顺序写为n个字节
+func littleEndian(value int64, n int) []byte {
+	result := make([]byte, n)
+	for i := range result {
+		result[i] = byte(value >> uint(i*8))
+	}
+	return result
+}
+
+// 写入缓存目录中0级的bundle文件，name如R0000C0000.bundle
+func writeTestBundleFile(t *testing.T, dir string, name string, content []byte) {
+	levelDir := filepath.Join(dir, "_alllayers", "L00")
+	if err := os.MkdirAll(levelDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(levelDir, name), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 生成10.1紧凑型bundle和bundlx：bundle为60字节头加“4字节长度+数据”的记录，
+// bundlx为16字节头、每个切片5字节的偏移量和16字节尾。records的键为切片顺序号，值为记录中的长度和数据
+func newCompactBundle(records map[int64]struct {
+	length int64
+	data   string
+}) ([]byte, []byte) {
+	var bundleData bytes.Buffer
+	bundleData.Write(make([]byte, 60))
+	index := make([]byte, 16+testPacketSize*testPacketSize*5+16)
+	for recordNumber, record := range records {
+		copy(index[16+recordNumber*5:], littleEndian(int64(bundleData.Len()), 5))
+		bundleData.Write(littleEndian(record.length, 4))
+		bundleData.WriteString(record.data)
+	}
+	return bundleData.Bytes(), index
+}
+
+func TestArcgisCache10_1GetTileBytes(t *testing.T) {
+	dir := writeTestCacheDir(t, StorageFormatCompact, "4")
+	bundleData, index := newCompactBundle(map[int64]struct {
+		length int64
+		data   string
+	}{
+		// 10.1的切片按列排列：顺序号 = 4 × 列 + 行
+		9: {3, "abc"},
+		1: {0, ""},
+		2: {1000, "x"},
+	})
+	writeTestBundleFile(t, dir, "R0000C0000.bundle", bundleData)
+	writeTestBundleFile(t, dir, "R0000C0000.bundlx", index)
+	// 索引被截断的bundle
+	writeTestBundleFile(t, dir, "R0004C0000.bundle", make([]byte, 60))
+	writeTestBundleFile(t, dir, "R0004C0000.bundlx", make([]byte, 20))
+
+	a, err := NewArcgisCache10_1(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name     string
+		row, col int64
+		want     string
+		err      error
+	}{
+		{"切片", 1, 2, "abc", nil},
+		{"长度为0", 1, 0, "", ErrTileNotFound},
+		{"没有偏移量", 3, 3, "", ErrTileNotFound},
+		{"长度超出bundle", 2, 0, "", ErrInvalidBundle},
+		{"索引被截断", 7, 3, "", ErrInvalidBundle},
+		{"bundle不存在", 0, 4, "", ErrBundleNotFound},
+	}
+	for _, tt := range tests {
+		data, err := a.GetTileBytes(0, tt.row, tt.col)
+		if err != tt.err || string(data) != tt.want {
+			t.Errorf("%s：切片为%q、错误为%v，期望%q、%v", tt.name, data, err, tt.want, tt.err)
+		}
+	}
+}
+
+// 生成紧凑型V2 bundle：64字节头、每个切片8字节的索引（低5字节为偏移量，高3字节为长度）和切片数据。
+// records的键为切片顺序号，length为负数时使用数据的实际长度
+func newCompactV2Bundle(records map[int64]struct {
+	length int64
+	data   string
+}) []byte {
+	indexSize := testPacketSize * testPacketSize * 8
+	content := make([]byte, 64+indexSize)
+	for recordNumber, record := range records {
+		length := record.length
+		if length < 0 {
+			length = int64(len(record.data))
+		}
+		copy(content[64+recordNumber*8:], littleEndian(int64(len(content)), 5))
+		copy(content[64+recordNumber*8+5:], littleEndian(length, 3))
+		content = append(content, record.data...)
+	}
+	return content
+}
+
+func TestArcgisCache10_3GetTileBytes(t *testing.T) {
+	// 长度超过255字节，长度跨越索引中的两个字节
+	long := string(bytes.Repeat([]byte("y"), 300))
+	dir := writeTestCacheDir(t, StorageFormatCompactV2, "4")
+	writeTestBundleFile(t, dir, "R0000C0000.bundle", newCompactV2Bundle(map[int64]struct {
+		length int64
+		data   string
+	}{
+		// 10.3的切片按行排列：顺序号 = 4 × 行 + 列
+		6:  {-1, "abc"},
+		7:  {-1, long},
+		1:  {0, ""},
+		15: {1 << 20, "z"},
+	}))
+	// 索引不完整的bundle
+	writeTestBundleFile(t, dir, "R0000C0004.bundle", make([]byte, 100))
+
+	a, err := NewArcgisCache10_3(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name     string
+		row, col int64
+		want     string
+		err      error
+	}{
+		{"切片", 1, 2, "abc", nil},
+		{"长度超过255字节", 1, 3, long, nil},
+		{"长度为0", 0, 1, "", ErrTileNotFound},
+		{"没有索引", 2, 2, "", ErrTileNotFound},
+		{"长度超出bundle", 3, 3, "", ErrInvalidBundle},
+		{"bundle不存在", 4, 0, "", ErrBundleNotFound},
+	}
+	for _, tt := range tests {
+		data, err := a.GetTileBytes(0, tt.row, tt.col)
+		if err != tt.err || string(data) != tt.want {
+			t.Errorf("%s：切片为%.8q、错误为%v，期望%.8q、%v", tt.name, data, err, tt.want, tt.err)
+		}
+	}
+
+	if _, err := a.GetTileBytes(0, 0, 4); err == nil {
+		t.Error("索引不完整的bundle没有返回错误")
+	}
+}
+
+// 记录是否已关闭的bundle文件
+type testBundleReader struct {
+	closed bool
+}
+
+func (r *testBundleReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, nil
+}
+
+func (r *testBundleReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestBundlePool(t *testing.T) {
+	p := newBundlePool(2)
+	readers := make(map[string]*testBundleReader)
+	opens := 0
+	get := func(key string) *bundle {
+		b, err := p.get(key, func() (*bundle, error) {
+			opens++
+			readers[key] = &testBundleReader{}
+			return &bundle{file: readers[key], modTime: time.Now()}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// 池中的bundle不重复打开
+	p.release(get("a/1"))
+	p.release(get("a/1"))
+	if opens != 1 {
+		t.Errorf("打开%d次，期望1次", opens)
+	}
+
+	// 超出数量时关闭最久未使用的bundle
+	p.release(get("a/2"))
+	p.release(get("b/1"))
+	if !readers["a/1"].closed || readers["a/2"].closed || readers["b/1"].closed {
+		t.Error("超出数量时没有只关闭最久未使用的bundle")
+	}
+
+	// 仍在读取的bundle被移除后，最后一次释放时才关闭
+	held := get("a/2")
+	p.release(get("b/2"))
+	p.release(get("b/3"))
+	if _, ok := p.items["a/2"]; ok {
+		t.Error("最久未使用的bundle没有从池中移除")
+	}
+	if readers["a/2"].closed {
+		t.Error("仍在读取的bundle被关闭")
+	}
+	p.release(held)
+	if !readers["a/2"].closed {
+		t.Error("释放后没有关闭已移除的bundle")
+	}
+
+	// 按前缀移除
+	p.purge("b/")
+	if p.ll.Len() != 0 || len(p.items) != 0 {
+		t.Errorf("按前缀移除后池中还有%d个bundle", p.ll.Len())
+	}
+	if !readers["b/2"].closed || !readers["b/3"].closed {
+		t.Error("按前缀移除时没有关闭bundle")
+	}
+}
+
+// 磁盘上的bundle被改写后重新打开
+func TestBundlePoolModified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "R0000C0000.bundle")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := newBundlePool(2)
+	opens := 0
+	open := func() (*bundle, error) {
+		opens++
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		return &bundle{file: &testBundleReader{}, path: path, size: info.Size(), modTime: info.ModTime()}, nil
+	}
+
+	b, _ := p.get(path, open)
+	p.release(b)
+	if err := ioutil.WriteFile(path, []byte("new data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 检查间隔内不检查文件
+	b, _ = p.get(path, open)
+	p.release(b)
+	if opens != 1 {
+		t.Errorf("检查间隔内打开%d次，期望1次", opens)
+	}
+
+	b.checked = time.Now().Add(-bundleCheckInterval)
+	b, _ = p.get(path, open)
+	p.release(b)
+	if opens != 2 || b.size != int64(len("new data")) {
+		t.Errorf("文件被改写后打开%d次、大小为%d，期望2次、%d", opens, b.size, len("new data"))
+	}
+}
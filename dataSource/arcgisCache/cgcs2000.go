@@ -0,0 +1,67 @@
+package arcgisCache
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// CGCS2000WKID CGCS2000地理坐标系
+const CGCS2000WKID = 4490
+
+// CGCS2000 3度带高斯-克吕格投影（中央经线114°E~135°E）的WKID
+var cgcs2000GKCMWKIDs = map[int64]int64{
+	114: 4547,
+	117: 4548,
+	120: 4549,
+	123: 4550,
+	126: 4551,
+	129: 4552,
+	132: 4553,
+	135: 4554,
+}
+
+var (
+	// GEOGCS["GCS_China_Geodetic_Coordinate_System_2000"或GEOGCS["China Geodetic Coordinate System 2000"
+	cgcs2000GeographicRegexp = regexp.MustCompile(`(?i)^GEOGCS\[\s*"(GCS_)?(China[ _]Geodetic[ _]Coordinate[ _]System[ _]2000|CGCS[ _]?2000)"`)
+	// PROJCS["CGCS2000_3_Degree_GK_CM_114E"或PROJCS["CGCS2000 / 3-degree Gauss-Kruger CM 114E"
+	cgcs2000GKCMRegexp = regexp.MustCompile(`(?i)^PROJCS\[\s*"CGCS[ _]?2000[ _/]*3[ _-]Degree[ _](GK|Gauss-Kruger)[ _]CM[ _](\d+)E"`)
+)
+
+// IsCGCS2000 是否为CGCS2000地理坐标系或3度带高斯-克吕格投影（WKID 4547~4554）
+func IsCGCS2000(sr conf.SpatialReference) bool {
+	wkid := sr.LatestWKID
+	if wkid == 0 {
+		wkid = sr.WKID
+	}
+	if wkid == 0 {
+		wkid = getCGCS2000WKID(sr.WKT)
+	}
+	return wkid == CGCS2000WKID || (wkid >= 4547 && wkid <= 4554)
+}
+
+// 根据WKT识别CGCS2000坐标系的WKID，无法识别时返回0
+func getCGCS2000WKID(wkt string) int64 {
+	wkt = strings.TrimSpace(wkt)
+	if cgcs2000GeographicRegexp.MatchString(wkt) {
+		return CGCS2000WKID
+	}
+	if matches := cgcs2000GKCMRegexp.FindStringSubmatch(wkt); matches != nil {
+		centralMeridian, _ := strconv.ParseInt(matches[2], 10, 64)
+		return cgcs2000GKCMWKIDs[centralMeridian]
+	}
+	return 0
+}
+
+// 补全空间参考的WKID：部分缓存的conf.xml中CGCS2000坐标系只有WKT或缺少LatestWKID
+func normalizeSpatialReference(sr conf.SpatialReference) conf.SpatialReference {
+	if sr.WKID == 0 && sr.LatestWKID == 0 {
+		sr.WKID = getCGCS2000WKID(sr.WKT)
+	}
+	if sr.LatestWKID == 0 && IsCGCS2000(sr) {
+		sr.LatestWKID = sr.WKID
+	}
+	return sr
+}
@@ -34,30 +34,30 @@ type CacheStorageInfo struct {
 
 type SpatialReference struct {
 	WKT           string
-	XOrigin       int64
-	YOrigin       int64
+	XOrigin       float64
+	YOrigin       float64
 	XYScale       float64
-	ZOrigin       int64
-	ZScale        int64
-	MOrigin       int64
-	MScale        int64
+	ZOrigin       float64
+	ZScale        float64
+	MOrigin       float64
+	MScale        float64
 	XYTolerance   float64
 	ZTolerance    float64
 	MTolerance    float64
 	HighPrecision bool
-	LeftLongitude int64
+	LeftLongitude float64
 	WKID          int64
 	LatestWKID    int64
 }
 
 type TileOrigin struct {
-	X int64
-	Y int64
+	X float64
+	Y float64
 }
 
 type LODInfo struct {
 	LevelID    int64
-	Scale      int64
+	Scale      float64
 	Resolution float64
 }
 
@@ -67,8 +67,9 @@ type LODInfo struct {
 
 // EnvelopeN 矩形闭包
 type EnvelopeN struct {
-	XMin float64
-	YMin float64
-	XMax float64
-	YMax float64
+	XMin             float64
+	YMin             float64
+	XMax             float64
+	YMax             float64
+	SpatialReference SpatialReference
 }
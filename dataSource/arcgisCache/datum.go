@@ -0,0 +1,191 @@
+package arcgisCache
+
+import (
+	"math"
+)
+
+// 坐标基准
+const (
+	DatumWGS84 = "wgs84"
+	DatumGCJ02 = "gcj02" // 国测局坐标，高德、腾讯等使用
+	DatumBD09  = "bd09"  // 百度坐标
+)
+
+// GCJ-02偏移参数（克拉索夫斯基椭球）
+const (
+	gcjA  = 6378245.0
+	gcjEE = 0.00669342162296594323
+	bdXPi = math.Pi * 3000.0 / 180.0
+)
+
+// 百度墨卡托投影分带参数
+var (
+	baiduMCBand = []float64{12890594.86, 8362377.87, 5591021, 3481989.83, 1678043.12, 0}
+	baiduLLBand = []float64{75, 60, 45, 30, 15, 0}
+	baiduMC2LL  = [][]float64{
+		{1.410526172116255e-8, 0.00000898305509648872, -1.9939833816331, 200.9824383106796, -187.2403703815547, 91.6087516669843, -23.38765649603339, 2.57121317296198, -0.03801003308653, 17337981.2},
+		{-7.435856389565537e-9, 0.000008983055097726239, -0.78625201886289, 96.32687599759846, -1.85204757529826, -59.36935905485877, 47.40033549296737, -16.50741931063887, 2.28786674699375, 10260144.86},
+		{-3.030883460898826e-8, 0.00000898305509983578, 0.30071316287616, 59.74293618442277, 7.357984074871, -25.38371002664745, 13.45380521110908, -3.29883767235584, 0.32710905363475, 6856817.37},
+		{-1.981981304930552e-8, 0.000008983055099779535, 0.03278182852591, 40.31678527705744, 0.65659298677277, -4.44255534477492, 0.85341911805263, 0.12923347998204, -0.04625736007561, 4482777.06},
+		{3.09191371068437e-9, 0.000008983055096812155, 0.00006995724062, 23.10934304144901, -0.00023663490511, -0.6321817810242, -0.00663494467273, 0.03430082397953, -0.00466043876332, 2555164.4},
+		{2.890871144776878e-9, 0.000008983055095805407, -3.068298e-8, 7.47137025468032, -0.00000353937994, -0.02145144861037, -0.00001234426596, 0.00010322952773, -0.00000323890364, 826088.5},
+	}
+	baiduLL2MC = [][]float64{
+		{-0.0015702102444, 111320.7020616939, 1704480524535203, -10338987376042340, 26112667856603880, -35149669176653700, 26595700718403920, -10725012454188240, 1800819912950474, 82.5},
+		{0.0008277824516172526, 111320.7020463578, 647795574.6671607, -4082003173.641316, 10774905663.51142, -15171875531.51559, 12053065338.62167, -5124939663.577472, 913311935.9512032, 67.5},
+		{0.00337398766765, 111320.7020202162, 4481351.045890365, -23393751.19931662, 79682215.47186455, -115964993.2797253, 97236711.15602145, -43661946.33752821, 8477230.501135234, 52.5},
+		{0.00220636496208, 111320.7020209128, 51751.86112841131, 3796837.749470245, 992013.7397791013, -1221952.21711287, 1340652.697009075, -620943.6990984312, 144416.9293806241, 37.5},
+		{-0.0003441963504368392, 111320.7020576856, 278.2353980772752, 2485758.690035394, 6070.750963243378, 54821.18345352118, 9540.606633304236, -2710.55326746645, 1405.483844121726, 22.5},
+		{-0.0003218135878613132, 111320.7020701615, 0.00369383431289, 823725.6402795718, 0.46104986909093, 2351.343141331292, 1.58060784298199, 8.77738589078284, 0.37238884252424, 7.45},
+	}
+)
+
+// WGS84ToGCJ02 WGS84转GCJ-02，国外坐标不偏移
+func WGS84ToGCJ02(lon float64, lat float64) (float64, float64) {
+	if isOutOfChina(lon, lat) {
+		return lon, lat
+	}
+	dLat := gcjTransformLat(lon-105, lat-35)
+	dLon := gcjTransformLon(lon-105, lat-35)
+	radLat := lat / 180 * math.Pi
+	magic := math.Sin(radLat)
+	magic = 1 - gcjEE*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+	dLat = dLat * 180 / ((gcjA * (1 - gcjEE)) / (magic * sqrtMagic) * math.Pi)
+	dLon = dLon * 180 / (gcjA / sqrtMagic * math.Cos(radLat) * math.Pi)
+	return lon + dLon, lat + dLat
+}
+
+// GCJ02ToWGS84 GCJ-02转WGS84，迭代求解
+func GCJ02ToWGS84(lon float64, lat float64) (float64, float64) {
+	if isOutOfChina(lon, lat) {
+		return lon, lat
+	}
+	wgsLon, wgsLat := lon, lat
+	for i := 0; i < 10; i++ {
+		gcjLon, gcjLat := WGS84ToGCJ02(wgsLon, wgsLat)
+		dLon, dLat := gcjLon-lon, gcjLat-lat
+		wgsLon, wgsLat = wgsLon-dLon, wgsLat-dLat
+		if math.Abs(dLon) < 1e-9 && math.Abs(dLat) < 1e-9 {
+			break
+		}
+	}
+	return wgsLon, wgsLat
+}
+
+// GCJ02ToBD09 GCJ-02转BD-09
+func GCJ02ToBD09(lon float64, lat float64) (float64, float64) {
+	z := math.Sqrt(lon*lon+lat*lat) + 0.00002*math.Sin(lat*bdXPi)
+	theta := math.Atan2(lat, lon) + 0.000003*math.Cos(lon*bdXPi)
+	return z*math.Cos(theta) + 0.0065, z*math.Sin(theta) + 0.006
+}
+
+// BD09ToGCJ02 BD-09转GCJ-02
+func BD09ToGCJ02(lon float64, lat float64) (float64, float64) {
+	x, y := lon-0.0065, lat-0.006
+	z := math.Sqrt(x*x+y*y) - 0.00002*math.Sin(y*bdXPi)
+	theta := math.Atan2(y, x) - 0.000003*math.Cos(x*bdXPi)
+	return z * math.Cos(theta), z * math.Sin(theta)
+}
+
+// WGS84ToBD09 WGS84转BD-09
+func WGS84ToBD09(lon float64, lat float64) (float64, float64) {
+	return GCJ02ToBD09(WGS84ToGCJ02(lon, lat))
+}
+
+// BD09ToWGS84 BD-09转WGS84
+func BD09ToWGS84(lon float64, lat float64) (float64, float64) {
+	return GCJ02ToWGS84(BD09ToGCJ02(lon, lat))
+}
+
+// BD09ToBaiduMercator BD-09经纬度转百度墨卡托
+func BD09ToBaiduMercator(lon float64, lat float64) (float64, float64) {
+	lat = math.Max(math.Min(lat, 74), -74)
+	factor := baiduLL2MC[len(baiduLL2MC)-1]
+	for i, band := range baiduLLBand {
+		if math.Abs(lat) >= band {
+			factor = baiduLL2MC[i]
+			break
+		}
+	}
+	return baiduConvert(lon, lat, factor)
+}
+
+// BaiduMercatorToBD09 百度墨卡托转BD-09经纬度
+func BaiduMercatorToBD09(x float64, y float64) (float64, float64) {
+	factor := baiduMC2LL[len(baiduMC2LL)-1]
+	for i, band := range baiduMCBand {
+		if math.Abs(y) >= band {
+			factor = baiduMC2LL[i]
+			break
+		}
+	}
+	return baiduConvert(x, y, factor)
+}
+
+// 百度墨卡托分带多项式换算
+func baiduConvert(x float64, y float64, factor []float64) (float64, float64) {
+	newX := factor[0] + factor[1]*math.Abs(x)
+	c := math.Abs(y) / factor[9]
+	newY := factor[2] + factor[3]*c + factor[4]*c*c + factor[5]*c*c*c + factor[6]*c*c*c*c +
+		factor[7]*c*c*c*c*c + factor[8]*c*c*c*c*c*c
+	if x < 0 {
+		newX = -newX
+	}
+	if y < 0 {
+		newY = -newY
+	}
+	return newX, newY
+}
+
+// 是否在中国境外，境外坐标不偏移
+func isOutOfChina(lon float64, lat float64) bool {
+	return lon < 72.004 || lon > 137.8347 || lat < 0.8293 || lat > 55.8271
+}
+
+func gcjTransformLat(x float64, y float64) float64 {
+	ret := -100 + 2*x + 3*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(y*math.Pi) + 40*math.Sin(y/3*math.Pi)) * 2 / 3
+	ret += (160*math.Sin(y/12*math.Pi) + 320*math.Sin(y*math.Pi/30)) * 2 / 3
+	return ret
+}
+
+func gcjTransformLon(x float64, y float64) float64 {
+	ret := 300 + x + 2*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(x*math.Pi) + 40*math.Sin(x/3*math.Pi)) * 2 / 3
+	ret += (150*math.Sin(x/12*math.Pi) + 300*math.Sin(x/30*math.Pi)) * 2 / 3
+	return ret
+}
+
+// 坐标基准转换函数，返回false表示不支持
+func getDatumTransform(from string, to string) (func(float64, float64) (float64, float64), bool) {
+	identity := func(lon float64, lat float64) (float64, float64) { return lon, lat }
+	toWGS84 := map[string]func(float64, float64) (float64, float64){
+		DatumWGS84: identity,
+		DatumGCJ02: GCJ02ToWGS84,
+		DatumBD09:  BD09ToWGS84,
+	}
+	fromWGS84 := map[string]func(float64, float64) (float64, float64){
+		DatumWGS84: identity,
+		DatumGCJ02: WGS84ToGCJ02,
+		DatumBD09:  WGS84ToBD09,
+	}
+	f, ok1 := toWGS84[from]
+	g, ok2 := fromWGS84[to]
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	switch {
+	case from == to:
+		return identity, true
+	case from == DatumGCJ02 && to == DatumBD09:
+		return GCJ02ToBD09, true
+	case from == DatumBD09 && to == DatumGCJ02:
+		return BD09ToGCJ02, true
+	}
+	return func(lon float64, lat float64) (float64, float64) {
+		return g(f(lon, lat))
+	}, true
+}
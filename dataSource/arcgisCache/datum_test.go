@@ -0,0 +1,98 @@
+package arcgisCache
+
+import (
+	"math"
+	"testing"
+)
+
+// 坐标转换函数
+type coordTransform func(float64, float64) (float64, float64)
+
+func TestDatumKnownPoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform coordTransform
+		x, y      float64
+		wantX     float64
+		wantY     float64
+		tolerance float64
+	}{
+		{"WGS84ToGCJ02上海", WGS84ToGCJ02, 121.5272106, 31.1774276, 121.531541859215, 31.17530398364597, 1e-9},
+		{"WGS84ToGCJ02北京", WGS84ToGCJ02, 116.404, 39.915, 116.41024449916938, 39.91640428150164, 1e-9},
+		{"GCJ02ToBD09", GCJ02ToBD09, 116.404, 39.915, 116.41036949371029, 39.92133699351021, 1e-9},
+		{"BD09ToGCJ02", BD09ToGCJ02, 116.404, 39.915, 116.39762729119315, 39.90865673957631, 1e-9},
+		{"WGS84ToGCJ02境外不偏移", WGS84ToGCJ02, 2.2945, 48.8584, 2.2945, 48.8584, 0},
+		{"GCJ02ToWGS84境外不偏移", GCJ02ToWGS84, -74.0445, 40.6892, -74.0445, 40.6892, 0},
+		{"BD09ToBaiduMercator", BD09ToBaiduMercator, 116.404, 39.915, 12958175.000248697, 4825923.766034242, 1e-3},
+	}
+	for _, tt := range tests {
+		x, y := tt.transform(tt.x, tt.y)
+		if math.Abs(x-tt.wantX) > tt.tolerance || math.Abs(y-tt.wantY) > tt.tolerance {
+			t.Errorf("%s(%v, %v) = (%v, %v)，期望(%v, %v)", tt.name, tt.x, tt.y, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+func TestDatumRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		forward   coordTransform
+		inverse   coordTransform
+		tolerance float64
+	}{
+		{"WGS84-GCJ02", WGS84ToGCJ02, GCJ02ToWGS84, 1e-8},
+		{"GCJ02-BD09", GCJ02ToBD09, BD09ToGCJ02, 1e-5},
+		{"WGS84-BD09", WGS84ToBD09, BD09ToWGS84, 1e-5},
+		{"BD09-百度墨卡托", BD09ToBaiduMercator, BaiduMercatorToBD09, 1e-5},
+	}
+	// 北京、上海、广州、乌鲁木齐、哈尔滨、三亚
+	points := [][2]float64{
+		{116.404, 39.915},
+		{121.4737, 31.2304},
+		{113.2644, 23.1291},
+		{87.6168, 43.8256},
+		{126.6425, 45.7570},
+		{109.5119, 18.2528},
+	}
+	for _, tt := range tests {
+		for _, p := range points {
+			x, y := tt.inverse(tt.forward(p[0], p[1]))
+			if math.Abs(x-p[0]) > tt.tolerance || math.Abs(y-p[1]) > tt.tolerance {
+				t.Errorf("%s往返转换(%v, %v)得到(%v, %v)", tt.name, p[0], p[1], x, y)
+			}
+		}
+	}
+}
+
+func TestGetDatumTransform(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{DatumWGS84, DatumWGS84, true},
+		{DatumWGS84, DatumGCJ02, true},
+		{DatumGCJ02, DatumBD09, true},
+		{DatumBD09, DatumWGS84, true},
+		{DatumWGS84, "cgcs2000", false},
+		{"", DatumBD09, false},
+	}
+	for _, tt := range tests {
+		transform, ok := getDatumTransform(tt.from, tt.to)
+		if ok != tt.ok {
+			t.Errorf("getDatumTransform(%q, %q)的ok = %v，期望%v", tt.from, tt.to, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// 与逐步转换的结果一致
+		lon, lat := 116.404, 39.915
+		x, y := transform(lon, lat)
+		inverse, _ := getDatumTransform(tt.to, tt.from)
+		backX, backY := inverse(x, y)
+		if math.Abs(backX-lon) > 1e-5 || math.Abs(backY-lat) > 1e-5 {
+			t.Errorf("%s到%s往返转换(%v, %v)得到(%v, %v)", tt.from, tt.to, lon, lat, backX, backY)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package arcgisCache
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// 切片格式，与MIME类型的子类型一致
+const (
+	TileFormatPNG  = "png"
+	TileFormatJPEG = "jpeg"
+	TileFormatWebP = "webp"
+	TileFormatGIF  = "gif"
+	TileFormatBMP  = "bmp"
+	TileFormatTIFF = "tiff"
+)
+
+var (
+	ErrUnsupportTileFormat = errors.New("不支持的切片格式")
+)
+
+// DetectTileFormat 根据文件头识别切片格式，无法识别时返回空字符串
+func DetectTileFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return TileFormatPNG
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return TileFormatJPEG
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return TileFormatWebP
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return TileFormatGIF
+	}
+	return ""
+}
+
+// NormalizeTileFormat 将缓存配置的切片格式（PNG8、PNG24、PNG32、JPEG、MIXED等）转为切片格式，
+// MIXED中的切片可能为JPEG或PNG，按PNG处理，实际格式以文件头为准
+func NormalizeTileFormat(cacheTileFormat string) string {
+	format := strings.ToLower(strings.TrimSpace(cacheTileFormat))
+	format = strings.TrimPrefix(format, "image/")
+	switch {
+	case strings.HasPrefix(format, "jp"):
+		return TileFormatJPEG
+	case format == TileFormatWebP, format == TileFormatGIF:
+		return format
+	}
+	return TileFormatPNG
+}
+
+// TranscodeTile 将切片转为指定格式（png、jpeg、webp），quality为JPEG质量，WebP为无损压缩
+func TranscodeTile(data []byte, format string, quality int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return EncodeImage(img, format, quality)
+}
+
+// EncodeImage 编码图片，format为png、jpeg、webp、gif、bmp或tiff，JPEG不支持透明，透明区域填充白色
+func EncodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case TileFormatJPEG:
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	case TileFormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case TileFormatWebP:
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+	case TileFormatGIF:
+		if err := gif.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+	case TileFormatBMP:
+		if err := bmp.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case TileFormatTIFF:
+		if err := tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportTileFormat
+	}
+	return buf.Bytes(), nil
+}
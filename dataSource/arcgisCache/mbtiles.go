@@ -0,0 +1,223 @@
+package arcgisCache
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+	// sqlite3驱动
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrInvalidMBTilesMetadata = errors.New("无效的MBTiles元数据")
+)
+
+// MBTiles MBTiles切片数据源
+type MBTiles struct {
+	Path      string
+	CacheInfo conf.CacheInfo
+	Envelope  conf.EnvelopeN
+	Metadata  Metadata // metadata表中的描述、版权等信息
+	db        *sql.DB
+}
+
+// NewMBTiles 根据路径创建一个新的MBTiles解析器
+func NewMBTiles(path string) (MBTiles, error) {
+	a := MBTiles{Path: path}
+	dsn, err := getMBTilesDSN(path)
+	if err != nil {
+		return a, err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return a, err
+	}
+	a.db = db
+
+	metadata, err := a.getMetadata()
+	if err != nil {
+		db.Close()
+		return a, err
+	}
+	a.CacheInfo, a.Envelope, err = getMBTilesCacheInfo(metadata)
+	if err != nil {
+		db.Close()
+		return a, err
+	}
+	a.Metadata = Metadata{
+		Description:   metadata["description"],
+		CopyrightText: metadata["attribution"],
+		DocumentInfo: DocumentInfo{
+			Title: metadata["name"],
+		},
+	}
+	return a, nil
+}
+
+// 生成只读打开MBTiles的SQLite URI。路径转为绝对路径并转义，文件名中的?、#、%不会被当作URI的参数或转义字符
+func getMBTilesDSN(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	absPath = filepath.ToSlash(absPath)
+	// Windows路径（如C:/data）前加/，否则盘符会被当作主机名
+	if !strings.HasPrefix(absPath, "/") {
+		absPath = "/" + absPath
+	}
+	return (&url.URL{Scheme: "file", Path: absPath, RawQuery: "mode=ro"}).String(), nil
+}
+
+// GetMapServerJSONString 获取MapServer的json字符串
+func (a *MBTiles) GetMapServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	return getMapServerJSONString(a.CacheInfo, a.Envelope, MergeMetadata(metadata, a.Metadata), false, pretty)
+}
+
+// GetMetadata 获取metadata表中的描述、版权等信息
+func (a *MBTiles) GetMetadata() Metadata {
+	return a.Metadata
+}
+
+// GetCacheInfo 获取切片配置信息
+func (a *MBTiles) GetCacheInfo() conf.CacheInfo {
+	return a.CacheInfo
+}
+
+// GetEnvelope 获取范围
+func (a *MBTiles) GetEnvelope() conf.EnvelopeN {
+	return a.Envelope
+}
+
+// GetTileFormat 获取瓦片格式：png、jpeg等
+func (a *MBTiles) GetTileFormat() string {
+	return NormalizeTileFormat(a.CacheInfo.TileImageInfo.CacheTileFormat)
+}
+
+// GetTileBytes 根据行列号获取切片
+func (a *MBTiles) GetTileBytes(level int64, row int64, col int64) ([]byte, error) {
+	if !hasLevel(a.CacheInfo, level) {
+		return nil, ErrLevelOutOfRange
+	}
+	if row < 0 || col < 0 {
+		return nil, ErrInvalidLevelRowCol
+	}
+
+	// MBTiles采用TMS行号，原点在左下角，需要翻转
+	tmsRow := (int64(1) << uint(level)) - 1 - row
+	if tmsRow < 0 {
+		return nil, ErrInvalidLevelRowCol
+	}
+
+	var imageData []byte
+	err := a.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`,
+		level, col, tmsRow).Scan(&imageData)
+	if err == sql.ErrNoRows || (err == nil && len(imageData) == 0) {
+		return nil, ErrTileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imageData, nil
+}
+
+// GetTileModTime 获取MBTiles文件的修改时间
+func (a *MBTiles) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Close 关闭数据库连接
+func (a *MBTiles) Close() error {
+	return a.db.Close()
+}
+
+// 读取metadata表
+func (a *MBTiles) getMetadata() (map[string]string, error) {
+	rows, err := a.db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		metadata[name] = value
+	}
+	return metadata, rows.Err()
+}
+
+// 根据metadata生成切片配置信息和范围
+func getMBTilesCacheInfo(metadata map[string]string) (conf.CacheInfo, conf.EnvelopeN, error) {
+	var cacheInfo conf.CacheInfo
+	var envelope conf.EnvelopeN
+
+	// 级别范围
+	minZoom, maxZoom := int64(0), int64(18)
+	if v, ok := metadata["minzoom"]; ok {
+		z, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+		}
+		minZoom = z
+	}
+	if v, ok := metadata["maxzoom"]; ok {
+		z, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+		}
+		maxZoom = z
+	}
+	if minZoom < 0 || maxZoom < minZoom || maxZoom > 30 {
+		return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+	}
+
+	// 切片格式
+	var format string
+	switch strings.ToLower(strings.TrimSpace(metadata["format"])) {
+	case "", "png":
+		format = "PNG"
+	case "jpg", "jpeg":
+		format = "JPEG"
+	case "webp":
+		format = "WEBP"
+	default:
+		return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+	}
+
+	cacheInfo = newWebMercatorCacheInfo(minZoom, maxZoom, format)
+
+	// 范围（经纬度转为Web墨卡托）
+	bounds := []float64{-180, -webMercatorMaxLat, 180, webMercatorMaxLat}
+	if v, ok := metadata["bounds"]; ok {
+		arr := strings.Split(v, ",")
+		if len(arr) != 4 {
+			return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+		}
+		for i, s := range arr {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return cacheInfo, envelope, ErrInvalidMBTilesMetadata
+			}
+			bounds[i] = f
+		}
+	}
+	envelope.XMin, envelope.YMin = LonLatToWebMercator(bounds[0], bounds[1])
+	envelope.XMax, envelope.YMax = LonLatToWebMercator(bounds[2], bounds[3])
+	envelope.SpatialReference = cacheInfo.TileCacheInfo.SpatialReference
+
+	return cacheInfo, envelope, nil
+}
@@ -0,0 +1,36 @@
+package arcgisCache
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 文件名中含有?、#、%和空格的MBTiles
+func TestNewMBTilesSpecialPath(t *testing.T) {
+	dir := t.TempDir()
+	tmpPath := filepath.Join(dir, "tmp.mbtiles")
+	db, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE metadata (name TEXT, value TEXT); INSERT INTO metadata VALUES ('name', '测试'), ('format', 'png');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "a b?c#d%20.mbtiles")
+	if err := os.Rename(tmpPath, path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMBTiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Metadata.DocumentInfo.Title != "测试" {
+		t.Errorf("标题为%q，期望%q", m.Metadata.DocumentInfo.Title, "测试")
+	}
+}
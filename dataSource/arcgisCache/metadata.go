@@ -0,0 +1,33 @@
+package arcgisCache
+
+// Metadata 服务元数据：描述、版权、能力、初始范围和文档信息，来自服务配置或缓存自带的信息
+type Metadata struct {
+	Description   string
+	CopyrightText string
+	Capabilities  string
+	InitialExtent Extent // 初始范围，坐标系与全图范围一致，全为0时使用全图范围
+	DocumentInfo  DocumentInfo
+}
+
+// Extent 矩形范围
+type Extent struct {
+	XMin float64
+	YMin float64
+	XMax float64
+	YMax float64
+}
+
+// IsEmpty 是否未设置范围
+func (e Extent) IsEmpty() bool {
+	return e == Extent{}
+}
+
+// DocumentInfo 文档信息
+type DocumentInfo struct {
+	Title    string
+	Author   string
+	Comments string
+	Subject  string
+	Category string
+	Keywords string
+}
@@ -0,0 +1,172 @@
+package arcgisCache
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+var (
+	ErrInvalidSpatialReference = errors.New("无效的空间参考")
+	ErrUnsupportTransform      = errors.New("不支持的坐标转换")
+	ErrTooManyTiles            = errors.New("范围内的切片过多")
+)
+
+// 拼接图片时最多读取的源切片数为输出图片所占切片数的倍数，缓存没有与输出分辨率相近的级别时
+// 最接近的级别可能精细得多，不限制时一次请求会读取、解码大量切片
+const maxRenderTileFactor = 4
+
+// ParseSpatialReference 解析请求中的空间参考，支持WKID（如4326）和json（如{"wkid":4326}）
+func ParseSpatialReference(value string) (conf.SpatialReference, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		var sr struct {
+			Wkid       int64  `json:"wkid"`
+			LatestWkid int64  `json:"latestWkid"`
+			Wkt        string `json:"wkt"`
+		}
+		if err := json.Unmarshal([]byte(value), &sr); err != nil {
+			return conf.SpatialReference{}, ErrInvalidSpatialReference
+		}
+		if sr.Wkid == 0 && sr.LatestWkid == 0 && sr.Wkt == "" {
+			return conf.SpatialReference{}, ErrInvalidSpatialReference
+		}
+		return normalizeSpatialReference(conf.SpatialReference{WKID: sr.Wkid, LatestWKID: sr.LatestWkid, WKT: sr.Wkt}), nil
+	}
+
+	// EPSG:4326形式
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		value = value[i+1:]
+	}
+	wkid, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || wkid <= 0 {
+		return conf.SpatialReference{}, ErrInvalidSpatialReference
+	}
+	return conf.SpatialReference{WKID: wkid}, nil
+}
+
+// GetTransform 获取坐标系之间的坐标转换，支持相同坐标系、地理坐标系与Web墨卡托之间的转换，
+// 地理坐标系之间（如WGS84与CGCS2000）不做转换
+func GetTransform(from conf.SpatialReference, to conf.SpatialReference) (func(float64, float64) (float64, float64), error) {
+	identity := func(x float64, y float64) (float64, float64) { return x, y }
+	fromMercator := IsWebMercator(from.WKID) || IsWebMercator(from.LatestWKID)
+	toMercator := IsWebMercator(to.WKID) || IsWebMercator(to.LatestWKID)
+	switch {
+	case IsSameSpatialReference(from, to), fromMercator && toMercator, IsGeographic(from) && IsGeographic(to):
+		return identity, nil
+	case IsGeographic(from) && toMercator:
+		return LonLatToWebMercator, nil
+	case fromMercator && IsGeographic(to):
+		return WebMercatorToLonLat, nil
+	}
+	return nil, ErrUnsupportTransform
+}
+
+// IsSameSpatialReference 是否为同一坐标系，都没有WKID时比较WKT
+func IsSameSpatialReference(a conf.SpatialReference, b conf.SpatialReference) bool {
+	if a.WKID == 0 && a.LatestWKID == 0 && b.WKID == 0 && b.LatestWKID == 0 {
+		return a.WKT == b.WKT
+	}
+	return getWKID(a) == getWKID(b) || (a.WKID != 0 && a.WKID == b.WKID)
+}
+
+// 获取坐标系的WKID，优先使用LatestWKID
+func getWKID(sr conf.SpatialReference) int64 {
+	if sr.LatestWKID != 0 {
+		return sr.LatestWKID
+	}
+	return sr.WKID
+}
+
+// RenderImage 拼接缓存切片并重采样为width×height的图片。范围为输出坐标系下的坐标，toCache为输出坐标到缓存坐标的转换，
+// 选取分辨率最接近的级别，返回图片和所用级别；范围内没有切片时返回透明图片，
+// 所选级别覆盖的切片过多时返回透明图片和ErrTooManyTiles
+func RenderImage(a ArcgisCache, xmin, ymin, xmax, ymax float64, width int, height int, toCache func(float64, float64) (float64, float64), resampling string) (*image.NRGBA, conf.LODInfo, error) {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	lodInfo, ok := selectLOD(a, xmin, ymin, xmax, ymax, width, height, toCache)
+	if !ok {
+		return dst, lodInfo, ErrLevelOutOfRange
+	}
+
+	if !checkRenderTileCount(a, lodInfo, xmin, ymin, xmax, ymax, width, height, toCache) {
+		return dst, lodInfo, ErrTooManyTiles
+	}
+
+	sampler := newTileSampler(a, lodInfo)
+	resolutionX := (xmax - xmin) / float64(width)
+	resolutionY := (ymax - ymin) / float64(height)
+	for py := 0; py < height; py++ {
+		y := ymax - (float64(py)+0.5)*resolutionY
+		for px := 0; px < width; px++ {
+			x := xmin + (float64(px)+0.5)*resolutionX
+			cx, cy := toCache(x, y)
+			var c color.NRGBA
+			var ok bool
+			if resampling == ResamplingNearest {
+				c, ok = sampler.nearest(cx, cy)
+			} else {
+				c, ok = sampler.bilinear(cx, cy)
+			}
+			if ok {
+				dst.SetNRGBA(px, py, c)
+			}
+		}
+		sampler.nextLine()
+	}
+	return dst, lodInfo, sampler.err
+}
+
+// 估算范围在所选级别下覆盖的切片数，是否未超出输出图片所占切片数的maxRenderTileFactor倍
+func checkRenderTileCount(a ArcgisCache, lodInfo conf.LODInfo, xmin, ymin, xmax, ymax float64, width int, height int, toCache func(float64, float64) (float64, float64)) bool {
+	tileCacheInfo := a.GetCacheInfo().TileCacheInfo
+	if tileCacheInfo.TileCols <= 0 || tileCacheInfo.TileRows <= 0 {
+		return false
+	}
+
+	// 范围转为缓存坐标系后的外接矩形
+	cxmin, cymin, cxmax, cymax := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{xmin, ymin}, {xmin, ymax}, {xmax, ymin}, {xmax, ymax}} {
+		x, y := toCache(corner[0], corner[1])
+		cxmin, cymin = math.Min(cxmin, x), math.Min(cymin, y)
+		cxmax, cymax = math.Max(cxmax, x), math.Max(cymax, y)
+	}
+	tileWidth := lodInfo.Resolution * float64(tileCacheInfo.TileCols)
+	tileHeight := lodInfo.Resolution * float64(tileCacheInfo.TileRows)
+	count := ((cxmax-cxmin)/tileWidth + 2) * ((cymax-cymin)/tileHeight + 2)
+
+	footprint := (float64(width)/float64(tileCacheInfo.TileCols) + 2) * (float64(height)/float64(tileCacheInfo.TileRows) + 2)
+	// count为NaN时也视为超出
+	return count <= maxRenderTileFactor*footprint
+}
+
+// 选取与输出分辨率最接近的级别，输出范围转为缓存坐标系后计算分辨率
+func selectLOD(a ArcgisCache, xmin, ymin, xmax, ymax float64, width int, height int, toCache func(float64, float64) (float64, float64)) (conf.LODInfo, bool) {
+	lodInfos := a.GetCacheInfo().TileCacheInfo.LODInfos
+	if len(lodInfos) == 0 || width <= 0 || height <= 0 {
+		return conf.LODInfo{}, false
+	}
+
+	// 取范围中心处一个像素在缓存坐标系下的大小
+	cx, cy := (xmin+xmax)/2, (ymin+ymax)/2
+	dx, dy := (xmax-xmin)/float64(width), (ymax-ymin)/float64(height)
+	x0, y0 := toCache(cx-dx/2, cy-dy/2)
+	x1, y1 := toCache(cx+dx/2, cy+dy/2)
+	resolution := math.Sqrt(math.Abs((x1 - x0) * (y1 - y0)))
+	if resolution <= 0 || math.IsNaN(resolution) || math.IsInf(resolution, 0) {
+		return conf.LODInfo{}, false
+	}
+
+	best := lodInfos[0]
+	for _, lodInfo := range lodInfos[1:] {
+		if math.Abs(math.Log(lodInfo.Resolution/resolution)) < math.Abs(math.Log(best.Resolution/resolution)) {
+			best = lodInfo
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,427 @@
+package arcgisCache
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// 重投影的目标坐标系
+const (
+	ReprojectWebMercator   = "3857"
+	ReprojectBaiduMercator = "bd09mc"
+)
+
+// 重采样方式
+const (
+	ResamplingBilinear = "bilinear"
+	ResamplingNearest  = "nearest"
+)
+
+var (
+	ErrUnsupportReprojection = errors.New("不支持的重投影")
+	ErrUnsupportDatumShift   = errors.New("不支持的坐标基准转换")
+	ErrUnsupportResampling   = errors.New("不支持的重采样方式")
+)
+
+// Reprojector 将地理坐标系或Web墨卡托缓存实时重投影、纠偏为Web墨卡托或百度切片的数据源
+type Reprojector struct {
+	Source     ArcgisCache
+	CacheInfo  conf.CacheInfo
+	Envelope   conf.EnvelopeN
+	Resampling string
+
+	fromTarget func(x float64, y float64) (float64, float64)     // 输出切片坐标转为输出基准的经纬度
+	toSource   func(lon float64, lat float64) (float64, float64) // 输出基准的经纬度转为源缓存坐标
+}
+
+// NewReprojector 创建重投影数据源。target为目标坐标系：3857（默认）或bd09mc；
+// datumShift为坐标基准转换，如wgs84-gcj02、gcj02-wgs84、wgs84-bd09，目标为bd09时输出百度切片；
+// resampling为重采样方式，为空时使用双线性
+func NewReprojector(source ArcgisCache, target string, datumShift string, resampling string) (*Reprojector, error) {
+	resampling = strings.ToLower(strings.TrimSpace(resampling))
+	switch resampling {
+	case "":
+		resampling = ResamplingBilinear
+	case ResamplingBilinear, ResamplingNearest:
+	default:
+		return nil, ErrUnsupportResampling
+	}
+
+	// 坐标基准
+	from, to := DatumWGS84, DatumWGS84
+	if datumShift = strings.ToLower(strings.TrimSpace(datumShift)); datumShift != "" {
+		datums := strings.Split(datumShift, "-")
+		if len(datums) != 2 {
+			return nil, ErrUnsupportDatumShift
+		}
+		from, to = datums[0], datums[1]
+	}
+	forward, ok := getDatumTransform(from, to)
+	if !ok {
+		return nil, ErrUnsupportDatumShift
+	}
+	inverse, _ := getDatumTransform(to, from)
+
+	// 源缓存坐标系
+	sourceCacheInfo := source.GetCacheInfo()
+	sourceSpatialReference := sourceCacheInfo.TileCacheInfo.SpatialReference
+	if len(sourceCacheInfo.TileCacheInfo.LODInfos) == 0 {
+		return nil, ErrUnsupportReprojection
+	}
+	var sourceFromLonLat, sourceToLonLat func(float64, float64) (float64, float64)
+	sourceMetersPerUnit := 1.0
+	switch {
+	case IsGeographic(sourceSpatialReference):
+		sourceFromLonLat = func(lon float64, lat float64) (float64, float64) { return lon, lat }
+		sourceToLonLat = sourceFromLonLat
+		sourceMetersPerUnit = metersPerDegree
+	case IsWebMercator(sourceSpatialReference.WKID) || IsWebMercator(sourceSpatialReference.LatestWKID):
+		sourceFromLonLat = LonLatToWebMercator
+		sourceToLonLat = WebMercatorToLonLat
+	default:
+		return nil, ErrUnsupportReprojection
+	}
+
+	// 源缓存最粗、最细级别的地面分辨率（米）
+	lodInfos := sourceCacheInfo.TileCacheInfo.LODInfos
+	coarsest, finest := lodInfos[0].Resolution, lodInfos[0].Resolution
+	for _, lodInfo := range lodInfos {
+		coarsest = math.Max(coarsest, lodInfo.Resolution)
+		finest = math.Min(finest, lodInfo.Resolution)
+	}
+	coarsest, finest = coarsest*sourceMetersPerUnit, finest*sourceMetersPerUnit
+
+	// 输出格式：JPEG保持JPEG，其余输出PNG
+	format := "PNG"
+	if strings.Contains(strings.ToUpper(sourceCacheInfo.TileImageInfo.CacheTileFormat), "JP") {
+		format = "JPEG"
+	}
+
+	// 输出切片方案，目标基准为BD-09时使用百度切片方案
+	target = strings.ToLower(strings.TrimSpace(target))
+	var cacheInfo conf.CacheInfo
+	var fromTarget, toTarget func(float64, float64) (float64, float64)
+	if to == DatumBD09 {
+		if target != "" && target != ReprojectBaiduMercator {
+			return nil, ErrUnsupportReprojection
+		}
+		minZoom := clampZoom(math.Round(18-math.Log2(coarsest)), 1, baiduMaxZoom)
+		maxZoom := clampZoom(math.Round(18-math.Log2(finest)), minZoom, baiduMaxZoom)
+		cacheInfo = newBaiduCacheInfo(minZoom, maxZoom, format)
+		fromTarget, toTarget = BaiduMercatorToBD09, BD09ToBaiduMercator
+	} else {
+		switch target {
+		case "", ReprojectWebMercator, "102100", "webmercator":
+		default:
+			return nil, ErrUnsupportReprojection
+		}
+		minZoom := clampZoom(math.Round(math.Log2(webMercatorResolution/coarsest)), 0, 30)
+		maxZoom := clampZoom(math.Round(math.Log2(webMercatorResolution/finest)), minZoom, 30)
+		cacheInfo = newWebMercatorCacheInfo(minZoom, maxZoom, format)
+		fromTarget, toTarget = WebMercatorToLonLat, LonLatToWebMercator
+	}
+	cacheInfo.TileImageInfo.CompressionQuality = sourceCacheInfo.TileImageInfo.CompressionQuality
+
+	// 范围转为输出坐标系
+	sourceEnvelope := source.GetEnvelope()
+	envelope := conf.EnvelopeN{SpatialReference: cacheInfo.TileCacheInfo.SpatialReference}
+	xmin, ymin := sourceToLonLat(sourceEnvelope.XMin, sourceEnvelope.YMin)
+	xmax, ymax := sourceToLonLat(sourceEnvelope.XMax, sourceEnvelope.YMax)
+	envelope.XMin, envelope.YMin = toTarget(forward(math.Max(xmin, -180), ymin))
+	envelope.XMax, envelope.YMax = toTarget(forward(math.Min(xmax, 180), ymax))
+
+	return &Reprojector{
+		Source:     source,
+		CacheInfo:  cacheInfo,
+		Envelope:   envelope,
+		Resampling: resampling,
+		fromTarget: fromTarget,
+		toSource: func(lon float64, lat float64) (float64, float64) {
+			return sourceFromLonLat(inverse(lon, lat))
+		},
+	}, nil
+}
+
+// 级别取整并限制在范围内
+func clampZoom(z float64, min int64, max int64) int64 {
+	if z < float64(min) {
+		return min
+	}
+	if z > float64(max) {
+		return max
+	}
+	return int64(z)
+}
+
+// GetMapServerJSONString 获取MapServer的json字符串
+func (a *Reprojector) GetMapServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	return getMapServerJSONString(a.CacheInfo, a.Envelope, MergeMetadata(metadata, a.Source.GetMetadata()), false, pretty)
+}
+
+// GetMetadata 获取源缓存的元数据
+func (a *Reprojector) GetMetadata() Metadata {
+	return a.Source.GetMetadata()
+}
+
+// GetCacheInfo 获取切片配置信息
+func (a *Reprojector) GetCacheInfo() conf.CacheInfo {
+	return a.CacheInfo
+}
+
+// GetEnvelope 获取范围
+func (a *Reprojector) GetEnvelope() conf.EnvelopeN {
+	return a.Envelope
+}
+
+// GetTileFormat 获取瓦片格式：png、jpeg等
+func (a *Reprojector) GetTileFormat() string {
+	return NormalizeTileFormat(a.CacheInfo.TileImageInfo.CacheTileFormat)
+}
+
+// GetTileBytes 根据行列号生成切片：读取覆盖该切片的源切片，逐像素重采样后编码
+func (a *Reprojector) GetTileBytes(level int64, row int64, col int64) ([]byte, error) {
+	lodInfo, ok := a.getLOD(level)
+	if !ok {
+		return nil, ErrLevelOutOfRange
+	}
+	tileCacheInfo := a.CacheInfo.TileCacheInfo
+	resolution := lodInfo.Resolution
+	tileSize := float64(tileCacheInfo.TileCols)
+	count := int64(math.Round(2 * math.Abs(tileCacheInfo.TileOrigin.X) / (resolution * tileSize)))
+	if row < 0 || col < 0 || row >= count || col >= count {
+		return nil, ErrInvalidLevelRowCol
+	}
+
+	sampler := newTileSampler(a.Source, a.sourceLOD(resolution))
+	size := int(tileCacheInfo.TileCols)
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	originX := tileCacheInfo.TileOrigin.X + float64(col)*resolution*tileSize
+	originY := tileCacheInfo.TileOrigin.Y - float64(row)*resolution*tileSize
+	for py := 0; py < size; py++ {
+		y := originY - (float64(py)+0.5)*resolution
+		for px := 0; px < size; px++ {
+			x := originX + (float64(px)+0.5)*resolution
+			sx, sy := a.toSource(a.fromTarget(x, y))
+			var c color.NRGBA
+			var ok bool
+			if a.Resampling == ResamplingNearest {
+				c, ok = sampler.nearest(sx, sy)
+			} else {
+				c, ok = sampler.bilinear(sx, sy)
+			}
+			if ok {
+				dst.SetNRGBA(px, py, c)
+			}
+		}
+		sampler.nextLine()
+	}
+	if sampler.err != nil {
+		return nil, sampler.err
+	}
+	if !sampler.found {
+		return nil, ErrTileNotFound
+	}
+	return encodeTile(dst, a.CacheInfo.TileImageInfo)
+}
+
+// GetTileModTime 获取切片中心对应的源切片的修改时间
+func (a *Reprojector) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	lodInfo, ok := a.getLOD(level)
+	if !ok {
+		return time.Time{}, ErrLevelOutOfRange
+	}
+	tileCacheInfo := a.CacheInfo.TileCacheInfo
+	x := tileCacheInfo.TileOrigin.X + (float64(col)+0.5)*lodInfo.Resolution*float64(tileCacheInfo.TileCols)
+	y := tileCacheInfo.TileOrigin.Y - (float64(row)+0.5)*lodInfo.Resolution*float64(tileCacheInfo.TileRows)
+	sx, sy := a.toSource(a.fromTarget(x, y))
+
+	sourceLOD := a.sourceLOD(lodInfo.Resolution)
+	sourceTileCacheInfo := a.Source.GetCacheInfo().TileCacheInfo
+	sourceCol := int64(math.Floor((sx - sourceTileCacheInfo.TileOrigin.X) / sourceLOD.Resolution / float64(sourceTileCacheInfo.TileCols)))
+	sourceRow := int64(math.Floor((sourceTileCacheInfo.TileOrigin.Y - sy) / sourceLOD.Resolution / float64(sourceTileCacheInfo.TileRows)))
+	return a.Source.GetTileModTime(sourceLOD.LevelID, sourceRow, sourceCol)
+}
+
+// Close 关闭源缓存
+func (a *Reprojector) Close() error {
+	return a.Source.Close()
+}
+
+// 获取输出切片方案的级别
+func (a *Reprojector) getLOD(level int64) (conf.LODInfo, bool) {
+	for _, lodInfo := range a.CacheInfo.TileCacheInfo.LODInfos {
+		if lodInfo.LevelID == level {
+			return lodInfo, true
+		}
+	}
+	return conf.LODInfo{}, false
+}
+
+// 选择源缓存级别：分辨率不低于目标分辨率（米）的最粗级别，都低于目标分辨率时取最细级别
+func (a *Reprojector) sourceLOD(resolution float64) conf.LODInfo {
+	sourceCacheInfo := a.Source.GetCacheInfo()
+	units := resolution / MetersPerUnit(sourceCacheInfo.TileCacheInfo.SpatialReference)
+	var best conf.LODInfo
+	found := false
+	finest := conf.LODInfo{Resolution: math.MaxFloat64}
+	for _, lodInfo := range sourceCacheInfo.TileCacheInfo.LODInfos {
+		if lodInfo.Resolution < finest.Resolution {
+			finest = lodInfo
+		}
+		if lodInfo.Resolution <= units*(1+1e-6) && (!found || lodInfo.Resolution > best.Resolution) {
+			best = lodInfo
+			found = true
+		}
+	}
+	if !found {
+		return finest
+	}
+	return best
+}
+
+// tileSampler 按源缓存一个级别的像素坐标取样，源切片只读取、解码一次
+type tileSampler struct {
+	source        ArcgisCache
+	lodInfo       conf.LODInfo
+	tileCacheInfo conf.TileCacheInfo
+	tiles         map[[2]int64]*sampledTile
+	line          int // 当前输出行号，用于释放不再使用的源切片
+
+	found bool  // 是否读取到了源切片
+	err   error // 读取源切片出现的非缺失错误
+}
+
+// sampledTile 已解码的源切片，缺失时img为nil
+type sampledTile struct {
+	img  image.Image
+	line int // 最后使用该切片的输出行号
+}
+
+func newTileSampler(source ArcgisCache, lodInfo conf.LODInfo) *tileSampler {
+	return &tileSampler{
+		source:        source,
+		lodInfo:       lodInfo,
+		tileCacheInfo: source.GetCacheInfo().TileCacheInfo,
+		tiles:         make(map[[2]int64]*sampledTile),
+	}
+}
+
+// 最邻近取样
+func (s *tileSampler) nearest(x float64, y float64) (color.NRGBA, bool) {
+	fx, fy := s.pixel(x, y)
+	return s.at(int64(math.Floor(fx+0.5)), int64(math.Floor(fy+0.5)))
+}
+
+// 双线性取样，缺失的像素不参与插值
+func (s *tileSampler) bilinear(x float64, y float64) (color.NRGBA, bool) {
+	fx, fy := s.pixel(x, y)
+	x0, y0 := math.Floor(fx), math.Floor(fy)
+	dx, dy := fx-x0, fy-y0
+
+	var r, g, b, alpha, weight float64
+	for _, p := range [4]struct {
+		x, y int64
+		w    float64
+	}{
+		{int64(x0), int64(y0), (1 - dx) * (1 - dy)},
+		{int64(x0) + 1, int64(y0), dx * (1 - dy)},
+		{int64(x0), int64(y0) + 1, (1 - dx) * dy},
+		{int64(x0) + 1, int64(y0) + 1, dx * dy},
+	} {
+		c, ok := s.at(p.x, p.y)
+		if !ok || p.w == 0 {
+			continue
+		}
+		// 按透明度加权，避免透明像素的颜色渗入
+		a := float64(c.A) * p.w
+		r += float64(c.R) * a
+		g += float64(c.G) * a
+		b += float64(c.B) * a
+		alpha += a
+		weight += p.w
+	}
+	if weight == 0 {
+		return color.NRGBA{}, false
+	}
+	if alpha == 0 {
+		return color.NRGBA{}, true
+	}
+	return color.NRGBA{
+		R: uint8(math.Round(r / alpha)),
+		G: uint8(math.Round(g / alpha)),
+		B: uint8(math.Round(b / alpha)),
+		A: uint8(math.Round(alpha / weight)),
+	}, true
+}
+
+// 坐标转为源级别的像素坐标，像素中心为整数
+func (s *tileSampler) pixel(x float64, y float64) (float64, float64) {
+	fx := (x-s.tileCacheInfo.TileOrigin.X)/s.lodInfo.Resolution - 0.5
+	fy := (s.tileCacheInfo.TileOrigin.Y-y)/s.lodInfo.Resolution - 0.5
+	return fx, fy
+}
+
+// 获取源级别的像素颜色，切片缺失时返回false
+func (s *tileSampler) at(px int64, py int64) (color.NRGBA, bool) {
+	if px < 0 || py < 0 {
+		return color.NRGBA{}, false
+	}
+	tileCols, tileRows := s.tileCacheInfo.TileCols, s.tileCacheInfo.TileRows
+	col, row := px/tileCols, py/tileRows
+	img := s.tile(row, col)
+	if img == nil {
+		return color.NRGBA{}, false
+	}
+	bounds := img.Bounds()
+	x, y := bounds.Min.X+int(px%tileCols), bounds.Min.Y+int(py%tileRows)
+	if !(image.Point{x, y}.In(bounds)) {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA), true
+}
+
+// 一行输出完成后调用，释放该行没有用到的源切片。输出按行从上到下，源切片也按行依次使用，
+// 一行中没有用到的源切片之后不再需要，内存中只保留约两行源切片
+func (s *tileSampler) nextLine() {
+	for key, t := range s.tiles {
+		if t.line < s.line {
+			delete(s.tiles, key)
+		}
+	}
+	s.line++
+}
+
+// 读取并解码源切片，缺失或无法解码时返回nil
+func (s *tileSampler) tile(row int64, col int64) image.Image {
+	key := [2]int64{row, col}
+	if t, ok := s.tiles[key]; ok {
+		t.line = s.line
+		return t.img
+	}
+	var img image.Image
+	data, err := s.source.GetTileBytes(s.lodInfo.LevelID, row, col)
+	if err == nil {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	switch {
+	case err == nil:
+		s.found = true
+	case err == ErrTileNotFound || err == ErrBundleNotFound || err == ErrInvalidLevelRowCol || err == ErrLevelOutOfRange:
+	case s.err == nil:
+		s.err = err
+	}
+	s.tiles[key] = &sampledTile{img: img, line: s.line}
+	return img
+}
+
+// 编码切片
+func encodeTile(img *image.NRGBA, tileImageInfo conf.TileImageInfo) ([]byte, error) {
+	return EncodeImage(img, NormalizeTileFormat(tileImageInfo.CacheTileFormat), int(tileImageInfo.CompressionQuality))
+}
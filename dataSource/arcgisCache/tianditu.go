@@ -0,0 +1,93 @@
+package arcgisCache
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+var (
+	ErrNotTiandituGrid = errors.New("不是天地图切片方案")
+)
+
+// 天地图切片矩阵集：c为经纬度（CGCS2000），w为Web墨卡托
+const (
+	TiandituMatrixSetC = "c"
+	TiandituMatrixSetW = "w"
+)
+
+// 天地图切片方案参数，级别从1开始
+const (
+	tiandituTileSize      = 256
+	tiandituResolutionC   = 1.40625 // 0级分辨率（度/像素），1级为2×1个切片覆盖全球
+	tiandituMinLevel      = 1
+	tiandituResolutionTol = 1e-4
+)
+
+// TiandituLevels 获取天地图级别到缓存级别的对应关系。c要求坐标系为地理坐标系、原点为(-180, 90)，
+// w要求为标准Web墨卡托切片方案，切片均为256像素，否则返回ErrNotTiandituGrid
+func TiandituLevels(cacheInfo conf.CacheInfo, matrixSet string) (map[int64]int64, error) {
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	if tileCacheInfo.TileCols != tiandituTileSize || tileCacheInfo.TileRows != tiandituTileSize {
+		return nil, ErrNotTiandituGrid
+	}
+
+	switch matrixSet {
+	case TiandituMatrixSetW:
+		// 天地图w级别与XYZ级别一致
+		webMercatorLevels, err := WebMercatorLevels(cacheInfo)
+		if err != nil {
+			return nil, ErrNotTiandituGrid
+		}
+		levels := make(map[int64]int64)
+		for z, level := range webMercatorLevels {
+			if z >= tiandituMinLevel {
+				levels[z] = level
+			}
+		}
+		return levels, nil
+	case TiandituMatrixSetC:
+		if !IsGeographic(tileCacheInfo.SpatialReference) {
+			return nil, ErrNotTiandituGrid
+		}
+		if math.Abs(tileCacheInfo.TileOrigin.X+180) > 1e-6 || math.Abs(tileCacheInfo.TileOrigin.Y-90) > 1e-6 {
+			return nil, ErrNotTiandituGrid
+		}
+
+		// 根据分辨率计算天地图级别
+		levels := make(map[int64]int64)
+		for _, lodInfo := range tileCacheInfo.LODInfos {
+			if lodInfo.Resolution <= 0 {
+				return nil, ErrNotTiandituGrid
+			}
+			n := math.Round(math.Log2(tiandituResolutionC / lodInfo.Resolution))
+			expected := tiandituResolutionC / math.Pow(2, n)
+			if math.Abs(lodInfo.Resolution-expected)/expected > tiandituResolutionTol {
+				return nil, ErrNotTiandituGrid
+			}
+			if n >= tiandituMinLevel {
+				levels[int64(n)] = lodInfo.LevelID
+			}
+		}
+		return levels, nil
+	}
+	return nil, ErrNotTiandituGrid
+}
+
+// TiandituMatrixSize 天地图切片矩阵的列数、行数
+func TiandituMatrixSize(matrixSet string, level int64) (int64, int64) {
+	width := int64(1) << uint(level)
+	if matrixSet == TiandituMatrixSetC {
+		return width, width / 2
+	}
+	return width, width
+}
+
+// TiandituResolution 天地图级别的分辨率，c为度/像素，w为米/像素
+func TiandituResolution(matrixSet string, level int64) float64 {
+	if matrixSet == TiandituMatrixSetC {
+		return tiandituResolutionC / math.Pow(2, float64(level))
+	}
+	return webMercatorResolution / math.Pow(2, float64(level))
+}
@@ -0,0 +1,96 @@
+package arcgisCache
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// 生成经纬度切片方案，分辨率为1.40625/2^n度（n从minN到maxN），级别号为n+offset
+func newGeographicCacheInfo(originX float64, originY float64, minN int64, maxN int64, offset int64) conf.CacheInfo {
+	lodInfos := []conf.LODInfo{}
+	for n := minN; n <= maxN; n++ {
+		lodInfos = append(lodInfos, conf.LODInfo{
+			LevelID:    n + offset,
+			Resolution: tiandituResolutionC / math.Pow(2, float64(n)),
+		})
+	}
+	return conf.CacheInfo{
+		TileCacheInfo: conf.TileCacheInfo{
+			SpatialReference: conf.SpatialReference{WKID: 4490, LatestWKID: 4490},
+			TileOrigin:       conf.TileOrigin{X: originX, Y: originY},
+			TileCols:         256,
+			TileRows:         256,
+			LODInfos:         lodInfos,
+		},
+	}
+}
+
+func TestTiandituLevels(t *testing.T) {
+	mercator512 := newWebMercatorCacheInfo(0, 3, "PNG")
+	mercator512.TileCacheInfo.TileCols, mercator512.TileCacheInfo.TileRows = 512, 512
+	mercatorOrigin := newWebMercatorCacheInfo(0, 3, "PNG")
+	mercatorOrigin.TileCacheInfo.TileOrigin.X = -400
+
+	tests := []struct {
+		name      string
+		cacheInfo conf.CacheInfo
+		matrixSet string
+		want      map[int64]int64
+		err       error
+	}{
+		{"w从1级开始", newWebMercatorCacheInfo(0, 4, "PNG"), TiandituMatrixSetW, map[int64]int64{1: 1, 2: 2, 3: 3, 4: 4}, nil},
+		{"c按分辨率对应", newGeographicCacheInfo(-180, 90, 0, 3, 10), TiandituMatrixSetC, map[int64]int64{1: 11, 2: 12, 3: 13}, nil},
+		{"c原点不同", newGeographicCacheInfo(-400, 400, 0, 3, 0), TiandituMatrixSetC, nil, ErrNotTiandituGrid},
+		{"c不是地理坐标系", newWebMercatorCacheInfo(0, 3, "PNG"), TiandituMatrixSetC, nil, ErrNotTiandituGrid},
+		{"w不是Web墨卡托", newGeographicCacheInfo(-180, 90, 0, 3, 0), TiandituMatrixSetW, nil, ErrNotTiandituGrid},
+		{"w原点不同", mercatorOrigin, TiandituMatrixSetW, nil, ErrNotTiandituGrid},
+		{"切片不是256像素", mercator512, TiandituMatrixSetW, nil, ErrNotTiandituGrid},
+		{"未知矩阵集", newWebMercatorCacheInfo(0, 3, "PNG"), "x", nil, ErrNotTiandituGrid},
+	}
+	for _, tt := range tests {
+		levels, err := TiandituLevels(tt.cacheInfo, tt.matrixSet)
+		if err != tt.err {
+			t.Errorf("%s：错误为%v，期望%v", tt.name, err, tt.err)
+			continue
+		}
+		if len(levels) != len(tt.want) {
+			t.Errorf("%s：级别为%v，期望%v", tt.name, levels, tt.want)
+			continue
+		}
+		for level, cacheLevel := range tt.want {
+			if levels[level] != cacheLevel {
+				t.Errorf("%s：级别为%v，期望%v", tt.name, levels, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTiandituLevelsNonStandardResolution(t *testing.T) {
+	cacheInfo := newGeographicCacheInfo(-180, 90, 0, 3, 0)
+	cacheInfo.TileCacheInfo.LODInfos[2].Resolution *= 1.01
+	if _, err := TiandituLevels(cacheInfo, TiandituMatrixSetC); err != ErrNotTiandituGrid {
+		t.Errorf("分辨率不是标准分辨率时错误为%v，期望%v", err, ErrNotTiandituGrid)
+	}
+}
+
+func TestTiandituMatrixSize(t *testing.T) {
+	tests := []struct {
+		matrixSet     string
+		level         int64
+		width, height int64
+	}{
+		{TiandituMatrixSetC, 1, 2, 1},
+		{TiandituMatrixSetC, 18, 262144, 131072},
+		{TiandituMatrixSetW, 1, 2, 2},
+		{TiandituMatrixSetW, 18, 262144, 262144},
+	}
+	for _, tt := range tests {
+		width, height := TiandituMatrixSize(tt.matrixSet, tt.level)
+		if width != tt.width || height != tt.height {
+			t.Errorf("TiandituMatrixSize(%q, %d) = (%d, %d)，期望(%d, %d)", tt.matrixSet, tt.level, width, height, tt.width, tt.height)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package arcgisCache
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+var (
+	ErrInvalidTilePackage = errors.New("无效的切片包")
+)
+
+// packageCache 切片包中的缓存，将缓存路径（Path/_alllayers/...）映射为包中bundle所在目录下的路径
+type packageCache struct {
+	pkg        *zipPackage
+	prefix     string // 缓存中bundle路径的前缀，即Path/_alllayers/
+	bundlesDir string // 包中bundle所在目录，以/结尾，如v101/Layers/_alllayers/、tile/
+}
+
+// 读取包中bundlx等文件的全部内容，文件不存在时返回ErrBundleNotFound
+func (c *packageCache) readFile(path string) ([]byte, error) {
+	data, err := c.pkg.readFile(c.bundlesDir + strings.TrimPrefix(path, c.prefix))
+	if err == ErrPackageFileNotFound {
+		return nil, ErrBundleNotFound
+	}
+	return data, err
+}
+
+// 打开包中的bundle文件，文件不存在时返回ErrBundleNotFound
+func (c *packageCache) openFile(path string) (bundleReader, os.FileInfo, error) {
+	f, info, err := c.pkg.openFile(c.bundlesDir + strings.TrimPrefix(path, c.prefix))
+	if err == ErrPackageFileNotFound {
+		return nil, nil, ErrBundleNotFound
+	}
+	return f, info, err
+}
+
+// bundle在文件池中的键，为包实例的键前缀加包中的路径
+func (c *packageCache) bundleKey(path string) string {
+	return c.pkg.keyPrefix + c.bundlesDir + strings.TrimPrefix(path, c.prefix)
+}
+
+// Close 关闭切片包
+func (c *packageCache) Close() error {
+	return c.pkg.Close()
+}
+
+// IsTilePackage 路径是否为切片包（tpk、tpkx）
+func IsTilePackage(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".tpk" || ext == ".tpkx"
+}
+
+// NewTilePackage 打开切片包，不解压直接读取包中的bundle。tpk中为conf.xml描述的紧凑型缓存（10.1或10.3），
+// tpkx中为root.json描述的紧凑型V2缓存，根据存储格式使用对应的缓存解析器
+func NewTilePackage(path string) (ArcgisCache, error) {
+	pkg, err := openZipPackage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheInfo conf.CacheInfo
+	var envelope conf.EnvelopeN
+	var bundlesDir string
+	if strings.ToLower(filepath.Ext(path)) == ".tpkx" {
+		cacheInfo, envelope, bundlesDir, err = getTPKXCacheInfo(pkg)
+	} else {
+		cacheInfo, envelope, bundlesDir, err = getTPKCacheInfo(pkg)
+	}
+	if err == nil {
+		err = checkPacketSize(cacheInfo)
+	}
+	if err != nil {
+		pkg.Close()
+		return nil, err
+	}
+
+	// iteminfo.xml中的元数据，没有范围时使用其中的经纬度范围
+	metadata, extent := getItemInfo(pkg)
+	if envelope == (conf.EnvelopeN{}) && !extent.IsEmpty() {
+		envelope = getItemInfoEnvelope(extent, cacheInfo.TileCacheInfo.SpatialReference)
+	}
+
+	packageCache := &packageCache{pkg: pkg, prefix: path + "/_alllayers/", bundlesDir: bundlesDir}
+	switch cacheInfo.CacheStorageInfo.StorageFormat {
+	case StorageFormatCompact:
+		return &ArcgisCache10_1{Path: path, CacheInfo: cacheInfo, Envelope: envelope, Metadata: metadata, pkg: packageCache}, nil
+	case StorageFormatCompactV2:
+		return &ArcgisCache10_3{Path: path, CacheInfo: cacheInfo, Envelope: envelope, Metadata: metadata, pkg: packageCache}, nil
+	}
+	pkg.Close()
+	return nil, ErrUnsupportStorageFormat
+}
+
+// 获取tpk的切片配置信息、范围和bundle所在目录，缓存目录为包中conf.xml所在目录（一般为v101/Layers）
+func getTPKCacheInfo(pkg *zipPackage) (conf.CacheInfo, conf.EnvelopeN, string, error) {
+	confPath := findPackageFile(pkg, "conf.xml")
+	if confPath == "" {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", ErrInvalidTilePackage
+	}
+	dir := strings.TrimSuffix(confPath, "conf.xml")
+	content, err := pkg.readFile(confPath)
+	if err != nil {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", err
+	}
+	cacheInfo, err := parseCacheInfo(content)
+	if err != nil {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", err
+	}
+
+	// conf.cdi可能不存在
+	var envelope conf.EnvelopeN
+	if content, err := pkg.readFile(dir + "conf.cdi"); err == nil {
+		if envelope, err = parseEnvelope(content); err != nil {
+			return conf.CacheInfo{}, conf.EnvelopeN{}, "", err
+		}
+	}
+	return cacheInfo, envelope, dir + "_alllayers/", nil
+}
+
+// tpkx的root.json
+type tpkxRoot struct {
+	TileBundlesPath string `json:"tileBundlesPath"`
+	TileImageInfo   struct {
+		Format             string `json:"format"`
+		CompressionQuality int64  `json:"compressionQuality"`
+	} `json:"tileImageInfo"`
+	StorageInfo struct {
+		PacketSize    int64  `json:"packetSize"`
+		StorageFormat string `json:"storageFormat"`
+	} `json:"storageInfo"`
+	TileInfo struct {
+		Rows               int64  `json:"rows"`
+		Cols               int64  `json:"cols"`
+		DPI                int64  `json:"dpi"`
+		Format             string `json:"format"`
+		CompressionQuality int64  `json:"compressionQuality"`
+		Origin             struct {
+			X float64 `json:"x"`
+			Y float64 `json:"y"`
+		} `json:"origin"`
+		SpatialReference tpkxSpatialReference `json:"spatialReference"`
+		LODs             []struct {
+			Level      int64   `json:"level"`
+			Resolution float64 `json:"resolution"`
+			Scale      float64 `json:"scale"`
+		} `json:"lods"`
+	} `json:"tileInfo"`
+	FullExtent struct {
+		XMin             float64              `json:"xmin"`
+		YMin             float64              `json:"ymin"`
+		XMax             float64              `json:"xmax"`
+		YMax             float64              `json:"ymax"`
+		SpatialReference tpkxSpatialReference `json:"spatialReference"`
+	} `json:"fullExtent"`
+}
+
+type tpkxSpatialReference struct {
+	WKID       int64  `json:"wkid"`
+	LatestWKID int64  `json:"latestWkid"`
+	WKT        string `json:"wkt"`
+}
+
+func (sr tpkxSpatialReference) toConf() conf.SpatialReference {
+	return normalizeSpatialReference(conf.SpatialReference{WKID: sr.WKID, LatestWKID: sr.LatestWKID, WKT: sr.WKT})
+}
+
+// 获取tpkx的切片配置信息、范围和bundle所在目录
+func getTPKXCacheInfo(pkg *zipPackage) (conf.CacheInfo, conf.EnvelopeN, string, error) {
+	content, err := pkg.readFile("root.json")
+	if err != nil {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", ErrInvalidTilePackage
+	}
+	var root tpkxRoot
+	if err := json.Unmarshal(content, &root); err != nil {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", err
+	}
+	if len(root.TileInfo.LODs) == 0 {
+		return conf.CacheInfo{}, conf.EnvelopeN{}, "", ErrInvalidTilePackage
+	}
+
+	var cacheInfo conf.CacheInfo
+	tileCacheInfo := &cacheInfo.TileCacheInfo
+	tileCacheInfo.SpatialReference = root.TileInfo.SpatialReference.toConf()
+	tileCacheInfo.TileOrigin = conf.TileOrigin{X: root.TileInfo.Origin.X, Y: root.TileInfo.Origin.Y}
+	tileCacheInfo.TileCols = root.TileInfo.Cols
+	tileCacheInfo.TileRows = root.TileInfo.Rows
+	tileCacheInfo.DPI = root.TileInfo.DPI
+	for _, lod := range root.TileInfo.LODs {
+		tileCacheInfo.LODInfos = append(tileCacheInfo.LODInfos, conf.LODInfo{
+			LevelID:    lod.Level,
+			Scale:      lod.Scale,
+			Resolution: lod.Resolution,
+		})
+	}
+	cacheInfo.TileImageInfo.CacheTileFormat = root.TileImageInfo.Format
+	if cacheInfo.TileImageInfo.CacheTileFormat == "" {
+		cacheInfo.TileImageInfo.CacheTileFormat = root.TileInfo.Format
+	}
+	cacheInfo.TileImageInfo.CompressionQuality = root.TileImageInfo.CompressionQuality
+	cacheInfo.CacheStorageInfo.StorageFormat = root.StorageInfo.StorageFormat
+	if cacheInfo.CacheStorageInfo.StorageFormat == "" {
+		cacheInfo.CacheStorageInfo.StorageFormat = StorageFormatCompactV2
+	}
+	cacheInfo.CacheStorageInfo.PacketSize = root.StorageInfo.PacketSize
+	if cacheInfo.CacheStorageInfo.PacketSize <= 0 {
+		cacheInfo.CacheStorageInfo.PacketSize = 128
+	}
+
+	envelope := conf.EnvelopeN{
+		XMin:             root.FullExtent.XMin,
+		YMin:             root.FullExtent.YMin,
+		XMax:             root.FullExtent.XMax,
+		YMax:             root.FullExtent.YMax,
+		SpatialReference: root.FullExtent.SpatialReference.toConf(),
+	}
+
+	// bundle所在目录，默认为./tile
+	bundlesDir := strings.Trim(strings.TrimPrefix(root.TileBundlesPath, "./"), "/")
+	if bundlesDir == "" {
+		bundlesDir = "tile"
+	}
+	return cacheInfo, envelope, bundlesDir + "/", nil
+}
+
+// iteminfo.xml
+type itemInfo struct {
+	Title             string         `xml:"title"`
+	Description       string         `xml:"description"`
+	Summary           string         `xml:"summary"`
+	AccessInformation string         `xml:"accessinformation"`
+	Tags              string         `xml:"tags"`
+	Extent            itemInfoExtent `xml:"extent"`
+}
+
+type itemInfoExtent struct {
+	XMin float64 `xml:"xmin"`
+	YMin float64 `xml:"ymin"`
+	XMax float64 `xml:"xmax"`
+	YMax float64 `xml:"ymax"`
+}
+
+// 获取iteminfo.xml中的元数据和经纬度范围，文件不存在或无效时返回空值
+func getItemInfo(pkg *zipPackage) (Metadata, Extent) {
+	itemInfoPath := findPackageFile(pkg, "iteminfo.xml")
+	if itemInfoPath == "" {
+		return Metadata{}, Extent{}
+	}
+	content, err := pkg.readFile(itemInfoPath)
+	if err != nil {
+		return Metadata{}, Extent{}
+	}
+	var info itemInfo
+	if err := xml.Unmarshal(content, &info); err != nil {
+		return Metadata{}, Extent{}
+	}
+
+	description := info.Description
+	if description == "" {
+		description = info.Summary
+	}
+	metadata := Metadata{
+		Description:   description,
+		CopyrightText: info.AccessInformation,
+		DocumentInfo: DocumentInfo{
+			Title:    info.Title,
+			Subject:  info.Summary,
+			Keywords: info.Tags,
+		},
+	}
+	return metadata, Extent{XMin: info.Extent.XMin, YMin: info.Extent.YMin, XMax: info.Extent.XMax, YMax: info.Extent.YMax}
+}
+
+// 将iteminfo.xml中的经纬度范围转为缓存坐标系，缓存为其他投影坐标系时保留经纬度
+func getItemInfoEnvelope(extent Extent, sr conf.SpatialReference) conf.EnvelopeN {
+	envelope := conf.EnvelopeN{XMin: extent.XMin, YMin: extent.YMin, XMax: extent.XMax, YMax: extent.YMax}
+	switch {
+	case IsWebMercator(sr.WKID) || IsWebMercator(sr.LatestWKID):
+		envelope.XMin, envelope.YMin = LonLatToWebMercator(extent.XMin, extent.YMin)
+		envelope.XMax, envelope.YMax = LonLatToWebMercator(extent.XMax, extent.YMax)
+		envelope.SpatialReference = sr
+	case IsGeographic(sr):
+		envelope.SpatialReference = sr
+	default:
+		envelope.SpatialReference = conf.SpatialReference{WKID: 4326, LatestWKID: 4326}
+	}
+	return envelope
+}
+
+// 在包中查找文件名为name的文件，有多个时取路径最短的，返回包内路径，不存在时返回空字符串
+func findPackageFile(pkg *zipPackage, name string) string {
+	found := ""
+	for path := range pkg.files {
+		if path != name && !strings.HasSuffix(path, "/"+name) {
+			continue
+		}
+		if found == "" || len(path) < len(found) || (len(path) == len(found) && path < found) {
+			found = path
+		}
+	}
+	return found
+}
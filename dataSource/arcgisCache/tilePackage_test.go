@@ -0,0 +1,139 @@
+package arcgisCache
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在临时目录中生成只包含指定文件的切片包，返回切片包路径
+func writeTestPackage(t *testing.T, name string, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for fileName, content := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: fileName, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 在临时目录中生成只包含指定文件的切片包并打开
+func openTestPackage(t *testing.T, name string, files map[string]string) *zipPackage {
+	pkg, err := openZipPackage(writeTestPackage(t, name, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pkg.Close() })
+	return pkg
+}
+
+func TestGetTPKXCacheInfo(t *testing.T) {
+	root := `{
+		"version": "1.0.0",
+		"tileBundlesPath": "./tiles/",
+		"tileImageInfo": {"format": "JPEG", "compressionQuality": 80},
+		"storageInfo": {"packetSize": 64, "storageFormat": "esriMapCacheStorageModeCompactV2"},
+		"tileInfo": {
+			"rows": 256, "cols": 256, "dpi": 96,
+			"origin": {"x": -20037508.342787, "y": 20037508.342787},
+			"spatialReference": {"wkid": 102100, "latestWkid": 3857},
+			"lods": [
+				{"level": 0, "resolution": 156543.03392800014, "scale": 591657527.591555},
+				{"level": 1, "resolution": 78271.51696399994, "scale": 295828763.795777}
+			]
+		},
+		"fullExtent": {"xmin": -100, "ymin": -50, "xmax": 100, "ymax": 50, "spatialReference": {"wkid": 102100, "latestWkid": 3857}}
+	}`
+	cacheInfo, envelope, bundlesDir, err := getTPKXCacheInfo(openTestPackage(t, "full.tpkx", map[string]string{"root.json": root}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileCacheInfo := cacheInfo.TileCacheInfo
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"bundle目录", bundlesDir, "tiles/"},
+		{"切片格式", cacheInfo.TileImageInfo.CacheTileFormat, "JPEG"},
+		{"压缩质量", cacheInfo.TileImageInfo.CompressionQuality, int64(80)},
+		{"存储格式", cacheInfo.CacheStorageInfo.StorageFormat, StorageFormatCompactV2},
+		{"bundle行列数", cacheInfo.CacheStorageInfo.PacketSize, int64(64)},
+		{"切片宽度", tileCacheInfo.TileCols, int64(256)},
+		{"切片高度", tileCacheInfo.TileRows, int64(256)},
+		{"DPI", tileCacheInfo.DPI, int64(96)},
+		{"原点X", tileCacheInfo.TileOrigin.X, -20037508.342787},
+		{"原点Y", tileCacheInfo.TileOrigin.Y, 20037508.342787},
+		{"坐标系", tileCacheInfo.SpatialReference.LatestWKID, int64(3857)},
+		{"级别数", len(tileCacheInfo.LODInfos), 2},
+		{"1级分辨率", tileCacheInfo.LODInfos[1].Resolution, 78271.51696399994},
+		{"1级比例尺", tileCacheInfo.LODInfos[1].Scale, 295828763.795777},
+		{"范围", [4]float64{envelope.XMin, envelope.YMin, envelope.XMax, envelope.YMax}, [4]float64{-100, -50, 100, 50}},
+		{"范围坐标系", envelope.SpatialReference.WKID, int64(102100)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s为%v，期望%v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// 没有存储信息、bundle目录时使用默认值，切片格式取自tileInfo
+func TestGetTPKXCacheInfoDefaults(t *testing.T) {
+	root := `{"tileInfo": {"rows": 256, "cols": 256, "format": "PNG32", "origin": {"x": -180, "y": 90},
+		"spatialReference": {"wkid": 4326}, "lods": [{"level": 0, "resolution": 0.703125, "scale": 295497593.05875}]}}`
+	cacheInfo, _, bundlesDir, err := getTPKXCacheInfo(openTestPackage(t, "defaults.tpkx", map[string]string{"root.json": root}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundlesDir != "tile/" {
+		t.Errorf("bundle目录为%q，期望%q", bundlesDir, "tile/")
+	}
+	if cacheInfo.TileImageInfo.CacheTileFormat != "PNG32" {
+		t.Errorf("切片格式为%q，期望%q", cacheInfo.TileImageInfo.CacheTileFormat, "PNG32")
+	}
+	if cacheInfo.CacheStorageInfo.StorageFormat != StorageFormatCompactV2 {
+		t.Errorf("存储格式为%q，期望%q", cacheInfo.CacheStorageInfo.StorageFormat, StorageFormatCompactV2)
+	}
+	if cacheInfo.CacheStorageInfo.PacketSize != 128 {
+		t.Errorf("bundle行列数为%d，期望128", cacheInfo.CacheStorageInfo.PacketSize)
+	}
+}
+
+func TestGetTPKXCacheInfoInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   error
+	}{
+		{"没有root.json", map[string]string{"tile/L00/R0000C0000.bundle": ""}, ErrInvalidTilePackage},
+		{"没有级别", map[string]string{"root.json": `{"tileInfo": {"rows": 256, "cols": 256, "lods": []}}`}, ErrInvalidTilePackage},
+	}
+	for _, tt := range tests {
+		_, _, _, err := getTPKXCacheInfo(openTestPackage(t, "invalid.tpkx", tt.files))
+		if err != tt.err {
+			t.Errorf("%s：错误为%v，期望%v", tt.name, err, tt.err)
+		}
+	}
+
+	// root.json格式错误
+	if _, _, _, err := getTPKXCacheInfo(openTestPackage(t, "broken.tpkx", map[string]string{"root.json": "{"})); err == nil {
+		t.Error("root.json格式错误时没有返回错误")
+	}
+}
@@ -0,0 +1,81 @@
+package arcgisCache
+
+import (
+	"strings"
+)
+
+// 能力中的tilemap标识，ArcGIS JS API据此请求tilemap
+const capabilityTileMap = "TileMap"
+
+// TileMapper 能根据bundle索引判断切片是否存在的缓存，用于ArcGIS的tilemap
+type TileMapper interface {
+	// GetTileMap 获取从(row, col)开始width×height范围内切片是否存在，按行排列，存在为1，不存在为0
+	GetTileMap(level int64, row int64, col int64, width int64, height int64) ([]int, error)
+}
+
+// GetTileMap 根据缓存索引获取切片是否存在，缓存不支持时返回false
+func GetTileMap(a ArcgisCache, level int64, row int64, col int64, width int64, height int64) ([]int, bool, error) {
+	tileMapper, ok := a.(TileMapper)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := tileMapper.GetTileMap(level, row, col, width, height)
+	return data, true, err
+}
+
+// 遍历范围内的切片读取bundle索引，同一bundle只从文件池获取一次；bundle不存在时其中的切片均不存在
+func getBundleTileMap(level int64, row int64, col int64, width int64, height int64,
+	getTileInfo func(int64, int64, int64) (string, int64, error),
+	getBundle func(string) (*bundle, error),
+	hasTile func(*bundle, int64) (bool, error)) ([]int, error) {
+	opened := make(map[string]*bundle)
+	defer func() {
+		for _, b := range opened {
+			if b != nil {
+				bundles.release(b)
+			}
+		}
+	}()
+
+	data := make([]int, width*height)
+	for r := int64(0); r < height; r++ {
+		for c := int64(0); c < width; c++ {
+			bundleFilePath, recordNumber, err := getTileInfo(level, row+r, col+c)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := opened[bundleFilePath]
+			if !ok {
+				b, err = getBundle(bundleFilePath)
+				if err == ErrBundleNotFound {
+					b, err = nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				opened[bundleFilePath] = b
+			}
+			if b == nil {
+				continue
+			}
+			exists, err := hasTile(b, recordNumber)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				data[r*width+c] = 1
+			}
+		}
+	}
+	return data, nil
+}
+
+// 在能力中加入TileMap
+func withTileMapCapability(capabilities string) string {
+	for _, capability := range strings.Split(capabilities, ",") {
+		if strings.EqualFold(strings.TrimSpace(capability), capabilityTileMap) {
+			return capabilities
+		}
+	}
+	return capabilities + "," + capabilityTileMap
+}
@@ -0,0 +1,127 @@
+package arcgisCache
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+// 坐标单位
+const (
+	UnitsDecimalDegrees = "esriDecimalDegrees"
+	UnitsMeters         = "esriMeters"
+	UnitsFeet           = "esriFeet"
+	UnitsUnknown        = "esriUnknownUnits"
+)
+
+// 赤道处每度对应的米数
+const metersPerDegree = 111319.49079327357
+
+// WKT中的UNIT["名称",换算系数]
+var wktUnitRegexp = regexp.MustCompile(`UNIT\[\s*"([^"]*)"\s*,\s*([0-9.eE+-]+)`)
+
+// EPSG的4000~4999中的投影坐标系编号范围（含两端），其余为地理坐标系
+var projectedEPSGRanges = [][2]int64{
+	{4026, 4026}, // MOLDREF99 / Moldova TM
+	{4037, 4038}, // WGS 84 / TMzn35N、TMzn36N
+	{4048, 4051}, // RGRDC 2005 / Congo TM
+	{4056, 4063}, // RGRDC 2005 / Congo TM、UTM
+	{4071, 4071}, // Chua / UTM zone 23S
+	{4082, 4083}, // REGCAN95 / UTM
+	{4087, 4088}, // World Equidistant Cylindrical
+	{4093, 4096}, // ETRS89 / DKTM
+	{4217, 4217}, // NAD83 / BLM 59N
+	{4390, 4439}, // Kertau (RSO)、NAD27/NAD83 / BLM、Pulkovo 1942(83) / Gauss-Kruger等
+	{4455, 4457}, // NAD27 / Pennsylvania South等
+	{4462, 4462}, // WGS 84 / Australian Centre for Remote Sensing Lambert
+	{4467, 4467}, // RGSPM06 / UTM zone 21N
+	{4471, 4471}, // RGM04 / UTM zone 38S
+	{4474, 4474}, // Cadastre 1997 / UTM zone 38S
+	{4484, 4489}, // Mexico ITRF92 / UTM
+	{4491, 4554}, // CGCS2000 / Gauss-Kruger
+	{4559, 4559}, // RRAF 1991 / UTM zone 20N
+	{4568, 4589}, // New Beijing / Gauss-Kruger
+	{4647, 4647}, // ETRS89 / UTM zone 32N (zE-N)
+	{4826, 4826}, // WGS 84 / Cape Verde National
+	{4839, 4839}, // ETRS89 / LCC Germany (N-E)
+	{4855, 4880}, // ETRS89 / NTM
+}
+
+// IsGeographic 是否为地理坐标系
+func IsGeographic(sr conf.SpatialReference) bool {
+	wkt := strings.ToUpper(strings.TrimSpace(sr.WKT))
+	if wkt != "" {
+		return strings.HasPrefix(wkt, "GEOGCS")
+	}
+
+	// 没有WKT时根据WKID判断：EPSG的4000~4999（除projectedEPSGRanges中的投影坐标系）、
+	// ESRI的37001~37260和104000~104999为地理坐标系
+	wkid := sr.LatestWKID
+	if wkid == 0 {
+		wkid = sr.WKID
+	}
+	for _, r := range projectedEPSGRanges {
+		if wkid >= r[0] && wkid <= r[1] {
+			return false
+		}
+	}
+	switch {
+	case wkid >= 4000 && wkid < 5000:
+		return true
+	case wkid >= 37001 && wkid <= 37260:
+		return true
+	case wkid >= 104000 && wkid < 105000:
+		return true
+	}
+	return false
+}
+
+// GetUnits 获取坐标系的单位
+func GetUnits(sr conf.SpatialReference) string {
+	if IsGeographic(sr) {
+		return UnitsDecimalDegrees
+	}
+
+	name, _, ok := getWKTLinearUnit(sr.WKT)
+	if !ok {
+		// 没有WKT的投影坐标系，默认为米
+		return UnitsMeters
+	}
+	switch name {
+	case "meter", "metre":
+		return UnitsMeters
+	case "foot", "foot_us", "foot_international":
+		return UnitsFeet
+	}
+	return UnitsUnknown
+}
+
+// MetersPerUnit 获取每个坐标单位对应的米数
+func MetersPerUnit(sr conf.SpatialReference) float64 {
+	if IsGeographic(sr) {
+		return metersPerDegree
+	}
+	if _, factor, ok := getWKTLinearUnit(sr.WKT); ok && factor > 0 {
+		return factor
+	}
+	return 1
+}
+
+// 获取投影坐标系WKT的线性单位：PROJCS中最后一个UNIT（GEOGCS中的UNIT为角度单位）
+func getWKTLinearUnit(wkt string) (string, float64, bool) {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(wkt)), "PROJCS") {
+		return "", 0, false
+	}
+	matches := wktUnitRegexp.FindAllStringSubmatch(wkt, -1)
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	last := matches[len(matches)-1]
+	factor, err := strconv.ParseFloat(last[2], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToLower(last[1]), factor, true
+}
@@ -0,0 +1,32 @@
+package arcgisCache
+
+import (
+	"testing"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+func TestIsGeographic(t *testing.T) {
+	tests := []struct {
+		name string
+		sr   conf.SpatialReference
+		want bool
+	}{
+		{"WGS84", conf.SpatialReference{WKID: 4326}, true},
+		{"CGCS2000", conf.SpatialReference{WKID: 4490, LatestWKID: 4490}, true},
+		{"ESRI地理坐标系", conf.SpatialReference{WKID: 104020}, true},
+		{"Web墨卡托", conf.SpatialReference{WKID: 102100, LatestWKID: 3857}, false},
+		{"World Equidistant Cylindrical", conf.SpatialReference{WKID: 4087}, false},
+		{"CGCS2000高斯-克吕格", conf.SpatialReference{WKID: 4547}, false},
+		{"Kertau RSO", conf.SpatialReference{WKID: 4390}, false},
+		{"Mexico ITRF92 UTM", conf.SpatialReference{WKID: 4489}, false},
+		{"ETRS89 NTM", conf.SpatialReference{WKID: 4860}, false},
+		{"以WKT为准", conf.SpatialReference{WKID: 4547, WKT: `GEOGCS["GCS_China_Geodetic_Coordinate_System_2000"]`}, true},
+		{"投影WKT", conf.SpatialReference{WKID: 4326, WKT: `PROJCS["x",GEOGCS["y"]]`}, false},
+	}
+	for _, tt := range tests {
+		if got := IsGeographic(tt.sr); got != tt.want {
+			t.Errorf("%s：IsGeographic为%v，期望%v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 
 	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
@@ -14,24 +15,44 @@ import (
 // GetArcgisCache 获取缓存对象
 func GetArcgisCache(path string) (ArcgisCache, error) {
 	var arcgisCache ArcgisCache
-	var err error
-	cacheInfo, _ := getCacheInfo(path)
-	arr := strings.Split(cacheInfo.Typens, "/")
-	if len(arr) > 0 {
-		version := arr[len(arr)-1]
-		if version < "10.1" {
-			err = ErrUnsupportCacheVersion
-		} else if version < "10.3" {
-			// 10.1，10.2
-			var arcgisCache10_1 ArcgisCache10_1
-			arcgisCache10_1, err = NewArcgisCache10_1(path)
-			arcgisCache = &arcgisCache10_1
-		} else {
-			// 10.3
-			var arcgisCache10_3 ArcgisCache10_3
-			arcgisCache10_3, err = NewArcgisCache10_3(path)
-			arcgisCache = &arcgisCache10_3
+
+	// 切片包
+	if IsTilePackage(path) {
+		return NewTilePackage(path)
+	}
+
+	// MBTiles文件
+	if strings.HasSuffix(strings.ToLower(path), ".mbtiles") {
+		mbtiles, err := NewMBTiles(path)
+		if err != nil {
+			return arcgisCache, err
 		}
+		return &mbtiles, nil
+	}
+
+	cacheInfo, err := getCacheInfo(path)
+	if err != nil {
+		return arcgisCache, err
+	}
+
+	// 根据存储格式选择缓存解析器
+	switch cacheInfo.CacheStorageInfo.StorageFormat {
+	case StorageFormatExploded:
+		var arcgisCacheExploded ArcgisCacheExploded
+		arcgisCacheExploded, err = NewArcgisCacheExploded(path)
+		arcgisCache = &arcgisCacheExploded
+	case StorageFormatCompact:
+		// 10.1，10.2
+		var arcgisCache10_1 ArcgisCache10_1
+		arcgisCache10_1, err = NewArcgisCache10_1(path)
+		arcgisCache = &arcgisCache10_1
+	case StorageFormatCompactV2:
+		// 10.3
+		var arcgisCache10_3 ArcgisCache10_3
+		arcgisCache10_3, err = NewArcgisCache10_3(path)
+		arcgisCache = &arcgisCache10_3
+	default:
+		err = ErrUnsupportStorageFormat
 	}
 
 	return arcgisCache, err
@@ -43,11 +64,17 @@ func getCacheInfo(path string) (conf.CacheInfo, error) {
 	if err != nil {
 		return conf.CacheInfo{}, err
 	}
+	return parseCacheInfo(content)
+}
+
+// parseCacheInfo 解析conf.xml
+func parseCacheInfo(content []byte) (conf.CacheInfo, error) {
 	var cacheInfo conf.CacheInfo
-	err = xml.Unmarshal(content, &cacheInfo)
+	err := xml.Unmarshal(content, &cacheInfo)
 	if err != nil {
 		return conf.CacheInfo{}, err
 	}
+	cacheInfo.TileCacheInfo.SpatialReference = normalizeSpatialReference(cacheInfo.TileCacheInfo.SpatialReference)
 	return cacheInfo, nil
 }
 
@@ -57,14 +84,39 @@ func getEnvelope(path string) (conf.EnvelopeN, error) {
 	if err != nil {
 		return conf.EnvelopeN{}, err
 	}
+	return parseEnvelope(content)
+}
+
+// parseEnvelope 解析conf.cdi
+func parseEnvelope(content []byte) (conf.EnvelopeN, error) {
 	var envelope conf.EnvelopeN
-	err = xml.Unmarshal(content, &envelope)
+	err := xml.Unmarshal(content, &envelope)
 	if err != nil {
 		return conf.EnvelopeN{}, err
 	}
+	envelope.SpatialReference = normalizeSpatialReference(envelope.SpatialReference)
 	return envelope, nil
 }
 
+// hasLevel 缓存中是否包含该级别
+func hasLevel(cacheInfo conf.CacheInfo, level int64) bool {
+	for _, lodInfo := range cacheInfo.TileCacheInfo.LODInfos {
+		if lodInfo.LevelID == level {
+			return true
+		}
+	}
+	return false
+}
+
+// openBundleFile 打开bundle或bundlx文件，文件不存在时返回ErrBundleNotFound
+func openBundleFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBundleNotFound
+	}
+	return f, err
+}
+
 // bytesToInt64 将从低位到高位存储的byte数组转为int64
 func bytesToInt64(bytes []byte) int64 {
 	var result int64
@@ -74,8 +126,40 @@ func bytesToInt64(bytes []byte) int64 {
 	return result
 }
 
-// 获取MapServer的json字符串
-func getMapServerJSONString(cacheInfo conf.CacheInfo, envelope conf.EnvelopeN, pretty bool) (string, error) {
+// GetServiceSpatialReference 获取服务的空间参考，投影坐标系（CGCS2000除外）或没有WKID时附带WKT
+func GetServiceSpatialReference(sr conf.SpatialReference) service.SpatialReference {
+	spatialReference := service.SpatialReference{
+		Wkid:       sr.WKID,
+		LatestWkid: sr.LatestWKID,
+	}
+	if sr.WKID == 0 || (!IsGeographic(sr) && !IsCGCS2000(sr)) {
+		spatialReference.Wkt = sr.WKT
+	}
+	return spatialReference
+}
+
+// MergeMetadata 合并元数据，metadata中为空的字段使用defaults中的值
+func MergeMetadata(metadata Metadata, defaults Metadata) Metadata {
+	if metadata.Description == "" {
+		metadata.Description = defaults.Description
+	}
+	if metadata.CopyrightText == "" {
+		metadata.CopyrightText = defaults.CopyrightText
+	}
+	if metadata.Capabilities == "" {
+		metadata.Capabilities = defaults.Capabilities
+	}
+	if metadata.InitialExtent.IsEmpty() {
+		metadata.InitialExtent = defaults.InitialExtent
+	}
+	if metadata.DocumentInfo == (DocumentInfo{}) {
+		metadata.DocumentInfo = defaults.DocumentInfo
+	}
+	return metadata
+}
+
+// 获取MapServer的json字符串，tileMap为缓存是否支持tilemap
+func getMapServerJSONString(cacheInfo conf.CacheInfo, envelope conf.EnvelopeN, metadata Metadata, tileMap bool, pretty bool) (string, error) {
 	lods := []service.Lod{}
 	for _, lodInfo := range cacheInfo.TileCacheInfo.LODInfos {
 		lods = append(lods, service.Lod{
@@ -84,20 +168,50 @@ func getMapServerJSONString(cacheInfo conf.CacheInfo, envelope conf.EnvelopeN, p
 			Scale:      lodInfo.Scale,
 		})
 	}
+	var minScale, maxScale float64
+	if len(lods) > 0 {
+		minScale = lods[0].Scale
+		maxScale = lods[len(lods)-1].Scale
+	}
+	spatialReference := GetServiceSpatialReference(cacheInfo.TileCacheInfo.SpatialReference)
+
+	// 范围的坐标系，conf.cdi中没有时使用切片的坐标系
+	extentSpatialReference := spatialReference
+	if envelope.SpatialReference.WKID != 0 || envelope.SpatialReference.WKT != "" {
+		extentSpatialReference = GetServiceSpatialReference(envelope.SpatialReference)
+	}
+	fullExtent := service.Extent{
+		XMin:             envelope.XMin,
+		YMin:             envelope.YMin,
+		XMax:             envelope.XMax,
+		YMax:             envelope.YMax,
+		SpatialReference: extentSpatialReference,
+	}
+	initialExtent := fullExtent
+	if !metadata.InitialExtent.IsEmpty() {
+		initialExtent.XMin = metadata.InitialExtent.XMin
+		initialExtent.YMin = metadata.InitialExtent.YMin
+		initialExtent.XMax = metadata.InitialExtent.XMax
+		initialExtent.YMax = metadata.InitialExtent.YMax
+	}
+	capabilities := metadata.Capabilities
+	if capabilities == "" {
+		capabilities = "Map,Query,Data"
+	}
+	if tileMap {
+		capabilities = withTileMapCapability(capabilities)
+	}
 	mapServer := service.MapServer{
 		CurrentVersion:        10.11,
 		ServiceDescription:    "",
 		MapName:               "Layers",
-		Description:           "",
-		CopyrightText:         "",
+		Description:           metadata.Description,
+		CopyrightText:         metadata.CopyrightText,
 		SupportsDynamicLayers: false,
 		Layers:                []interface{}{},
 		Tables:                []interface{}{},
-		SpatialReference: service.SpatialReference{
-			Wkid:       cacheInfo.TileCacheInfo.SpatialReference.WKID,
-			LatestWkid: cacheInfo.TileCacheInfo.SpatialReference.LatestWKID,
-		},
-		SingleFusedMapCache: true,
+		SpatialReference:      spatialReference,
+		SingleFusedMapCache:   true,
 		TileInfo: service.TileInfo{
 			Rows:               cacheInfo.TileCacheInfo.TileRows,
 			Cols:               cacheInfo.TileCacheInfo.TileCols,
@@ -108,47 +222,26 @@ func getMapServerJSONString(cacheInfo conf.CacheInfo, envelope conf.EnvelopeN, p
 				X: cacheInfo.TileCacheInfo.TileOrigin.X,
 				Y: cacheInfo.TileCacheInfo.TileOrigin.Y,
 			},
-			SpatialReference: service.SpatialReference{
-				Wkid:       cacheInfo.TileCacheInfo.SpatialReference.WKID,
-				LatestWkid: cacheInfo.TileCacheInfo.SpatialReference.LatestWKID,
-			},
-			Lods: lods,
-		},
-		InitialExtent: service.Extent{
-			XMin: envelope.XMin,
-			YMin: envelope.YMin,
-			XMax: envelope.XMax,
-			YMax: envelope.YMax,
-			SpatialReference: service.SpatialReference{
-				Wkid:       cacheInfo.TileCacheInfo.SpatialReference.WKID,
-				LatestWkid: cacheInfo.TileCacheInfo.SpatialReference.LatestWKID,
-			},
-		},
-		FullExtent: service.Extent{
-			XMin: envelope.XMin,
-			YMin: envelope.YMin,
-			XMax: envelope.XMax,
-			YMax: envelope.YMax,
-			SpatialReference: service.SpatialReference{
-				Wkid:       cacheInfo.TileCacheInfo.SpatialReference.WKID,
-				LatestWkid: cacheInfo.TileCacheInfo.SpatialReference.LatestWKID,
-			},
+			SpatialReference: spatialReference,
+			Lods:             lods,
 		},
-		MinScale: lods[0].Scale,
-		MaxScale: lods[len(lods)-1].Scale,
-		Units:    "esriDecimalDegrees",
-		SupportedImageFormatTypes: "PNG32,PNG24,PNG,JPG,DIB,TIFF,EMF,PS,PDF,GIF,SVG,SVGZ,BMP",
+		InitialExtent:             initialExtent,
+		FullExtent:                fullExtent,
+		MinScale:                  minScale,
+		MaxScale:                  maxScale,
+		Units:                     GetUnits(cacheInfo.TileCacheInfo.SpatialReference),
+		SupportedImageFormatTypes: "PNG32,PNG24,PNG,PNG8,JPG,JPGPNG,GIF,BMP,TIFF",
 		DocumentInfo: service.DocumentInfo{
-			Title:                "",
-			Author:               "",
-			Comments:             "",
-			Subject:              "",
-			Category:             "",
+			Title:                metadata.DocumentInfo.Title,
+			Author:               metadata.DocumentInfo.Author,
+			Comments:             metadata.DocumentInfo.Comments,
+			Subject:              metadata.DocumentInfo.Subject,
+			Category:             metadata.DocumentInfo.Category,
 			AntialiasingMode:     "None",
 			TextAntialiasingMode: "Force",
-			Keywords:             "",
+			Keywords:             metadata.DocumentInfo.Keywords,
 		},
-		Capabilities:          "Map,Query,Data",
+		Capabilities:          capabilities,
 		SupportedQueryFormats: "JSON, AMF",
 		MaxRecordCount:        1000,
 		MaxImageHeight:        2048,
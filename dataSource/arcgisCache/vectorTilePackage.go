@@ -0,0 +1,186 @@
+package arcgisCache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidVectorTilePackage = errors.New("无效的矢量切片包")
+)
+
+// 矢量切片包中数据所在目录
+const vtpkRoot = "p12/"
+
+// 矢量切片包bundle的行列数
+const vtpkPacketSize = 128
+
+// VectorTilePackage 矢量切片包（vtpk），切片为紧凑型V2 bundle中gzip压缩的PBF，
+// 样式、符号和字体位于resources目录
+type VectorTilePackage struct {
+	Path     string
+	RootJSON map[string]interface{} // p12/root.json，即VectorTileServer的json
+	levels   map[int64]bool
+	pkg      *zipPackage
+}
+
+// IsVectorTilePackage 路径是否为矢量切片包
+func IsVectorTilePackage(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".vtpk")
+}
+
+// NewVectorTilePackage 根据路径打开矢量切片包
+func NewVectorTilePackage(path string) (VectorTilePackage, error) {
+	v := VectorTilePackage{Path: path}
+	pkg, err := openZipPackage(path)
+	if err != nil {
+		return v, err
+	}
+
+	content, err := pkg.readFile(vtpkRoot + "root.json")
+	if err != nil {
+		pkg.Close()
+		return v, ErrInvalidVectorTilePackage
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v.RootJSON); err != nil {
+		pkg.Close()
+		return v, err
+	}
+
+	// 级别
+	var info struct {
+		TileInfo struct {
+			Lods []struct {
+				Level int64 `json:"level"`
+			} `json:"lods"`
+		} `json:"tileInfo"`
+	}
+	if err := json.Unmarshal(content, &info); err != nil || len(info.TileInfo.Lods) == 0 {
+		pkg.Close()
+		return v, ErrInvalidVectorTilePackage
+	}
+	v.levels = make(map[int64]bool)
+	for _, lod := range info.TileInfo.Lods {
+		v.levels[lod.Level] = true
+	}
+	v.pkg = pkg
+	return v, nil
+}
+
+// GetVectorTileServerJSONString 获取VectorTileServer的json字符串，metadata中不为空的描述、版权覆盖包中的值
+func (v *VectorTilePackage) GetVectorTileServerJSONString(metadata Metadata, pretty bool) (string, error) {
+	root := make(map[string]interface{}, len(v.RootJSON))
+	for key, value := range v.RootJSON {
+		root[key] = value
+	}
+	if metadata.Description != "" {
+		root["description"] = metadata.Description
+	}
+	if metadata.CopyrightText != "" {
+		root["copyrightText"] = metadata.CopyrightText
+	}
+	capabilities, _ := root["capabilities"].(string)
+	if metadata.Capabilities != "" {
+		capabilities = metadata.Capabilities
+	}
+	if capabilities == "" {
+		capabilities = "TilesOnly"
+	}
+	root["capabilities"] = withTileMapCapability(capabilities)
+
+	// 转为json
+	var jsonBytes []byte
+	var err error
+	if pretty {
+		jsonBytes, err = json.MarshalIndent(root, "", "  ")
+	} else {
+		jsonBytes, err = json.Marshal(root)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// GetTileBytes 根据级别、行、列号获取切片，一般为gzip压缩的PBF
+func (v *VectorTilePackage) GetTileBytes(level int64, row int64, col int64) ([]byte, error) {
+	bundleFilePath, recordNumber, err := v.getTileInfo(level, row, col)
+	if err != nil {
+		return nil, err
+	}
+	b, err := v.getBundle(bundleFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundles.release(b)
+	return getCompactV2ImageData(b, recordNumber)
+}
+
+// GetTileModTime 获取切片所在bundle的修改时间
+func (v *VectorTilePackage) GetTileModTime(level int64, row int64, col int64) (time.Time, error) {
+	bundleFilePath, _, err := v.getTileInfo(level, row, col)
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := v.getBundle(bundleFilePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer bundles.release(b)
+	return b.modTime, nil
+}
+
+// GetTileMap 根据bundle头部索引获取范围内切片是否存在
+func (v *VectorTilePackage) GetTileMap(level int64, row int64, col int64, width int64, height int64) ([]int, error) {
+	return getBundleTileMap(level, row, col, width, height, v.getTileInfo, v.getBundle, hasCompactV2Tile)
+}
+
+// GetResource 获取resources目录下的样式、符号、字体等文件，name如styles/root.json
+func (v *VectorTilePackage) GetResource(name string) ([]byte, error) {
+	return v.pkg.readFile(vtpkRoot + "resources/" + name)
+}
+
+// Close 关闭矢量切片包
+func (v *VectorTilePackage) Close() error {
+	return v.pkg.Close()
+}
+
+// 根据级别、行、列号获取bundle在包中的路径和切片顺序号
+func (v *VectorTilePackage) getTileInfo(level int64, row int64, col int64) (string, int64, error) {
+	if !v.levels[level] {
+		return "", 0, ErrLevelOutOfRange
+	}
+	if row < 0 || col < 0 {
+		return "", 0, ErrInvalidLevelRowCol
+	}
+	rowIndex := (row / vtpkPacketSize) * vtpkPacketSize
+	colIndex := (col / vtpkPacketSize) * vtpkPacketSize
+	bundleFilePath := fmt.Sprintf(`%stile/L%02d/R%04XC%04X.bundle`, vtpkRoot, level, rowIndex, colIndex)
+	recordNumber := vtpkPacketSize*(row-rowIndex) + (col - colIndex)
+	return bundleFilePath, recordNumber, nil
+}
+
+// 从bundle文件池获取bundle，使用完毕后需调用bundles.release
+func (v *VectorTilePackage) getBundle(bundleFilePath string) (*bundle, error) {
+	return bundles.get(v.pkg.keyPrefix+bundleFilePath, func() (*bundle, error) {
+		return v.openBundle(bundleFilePath)
+	})
+}
+
+// 打开包中的bundle并读取头部的切片索引
+func (v *VectorTilePackage) openBundle(bundleFilePath string) (*bundle, error) {
+	f, info, err := v.pkg.openFile(bundleFilePath)
+	if err == ErrPackageFileNotFound {
+		return nil, ErrBundleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readCompactV2Bundle(f, vtpkPacketSize, info)
+}
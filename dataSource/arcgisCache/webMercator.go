@@ -0,0 +1,114 @@
+package arcgisCache
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+var (
+	ErrNotWebMercatorGrid = errors.New("不是标准Web墨卡托切片方案")
+)
+
+// Web墨卡托切片方案参数
+const (
+	webMercatorWKID       = 102100
+	webMercatorLatestWKID = 3857
+	webMercatorHalfSize   = 20037508.342787
+	webMercatorResolution = 156543.03392800014 // 0级分辨率（米/像素）
+	webMercatorScale      = 591657527.591555   // 0级比例尺（96DPI）
+	webMercatorTileSize   = 256
+	webMercatorMaxLat     = 85.0511287798066
+)
+
+// LonLatToWebMercator 经纬度转Web墨卡托
+func LonLatToWebMercator(lon float64, lat float64) (float64, float64) {
+	lat = math.Max(math.Min(lat, webMercatorMaxLat), -webMercatorMaxLat)
+	x := lon * webMercatorHalfSize / 180
+	y := math.Log(math.Tan((90+lat)*math.Pi/360)) / (math.Pi / 180)
+	y = y * webMercatorHalfSize / 180
+	return x, y
+}
+
+// WebMercatorToLonLat Web墨卡托转经纬度
+func WebMercatorToLonLat(x float64, y float64) (float64, float64) {
+	lon := x / webMercatorHalfSize * 180
+	lat := y / webMercatorHalfSize * 180
+	lat = 180 / math.Pi * (2*math.Atan(math.Exp(lat*math.Pi/180)) - math.Pi/2)
+	return lon, lat
+}
+
+// IsWebMercator 是否为Web墨卡托坐标系
+func IsWebMercator(wkid int64) bool {
+	switch wkid {
+	case 102100, 102113, 3857, 900913:
+		return true
+	}
+	return false
+}
+
+// WebMercatorLevels 获取XYZ级别到缓存级别的对应关系。要求坐标系为Web墨卡托、原点为左上角、
+// 切片为256或512像素的正方形，且每级分辨率为标准分辨率，否则返回ErrNotWebMercatorGrid
+func WebMercatorLevels(cacheInfo conf.CacheInfo) (map[int64]int64, error) {
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	sr := tileCacheInfo.SpatialReference
+	if !IsWebMercator(sr.WKID) && !IsWebMercator(sr.LatestWKID) {
+		return nil, ErrNotWebMercatorGrid
+	}
+	if math.Abs(tileCacheInfo.TileOrigin.X+webMercatorHalfSize) > 1 || math.Abs(tileCacheInfo.TileOrigin.Y-webMercatorHalfSize) > 1 {
+		return nil, ErrNotWebMercatorGrid
+	}
+	tileSize := tileCacheInfo.TileCols
+	if tileSize != tileCacheInfo.TileRows || (tileSize != 256 && tileSize != 512) {
+		return nil, ErrNotWebMercatorGrid
+	}
+
+	// 根据分辨率计算XYZ级别
+	resolution := webMercatorResolution * webMercatorTileSize / float64(tileSize)
+	levels := make(map[int64]int64)
+	for _, lodInfo := range tileCacheInfo.LODInfos {
+		if lodInfo.Resolution <= 0 {
+			return nil, ErrNotWebMercatorGrid
+		}
+		z := math.Round(math.Log2(resolution / lodInfo.Resolution))
+		expected := resolution / math.Pow(2, z)
+		if z < 0 || math.Abs(lodInfo.Resolution-expected)/expected > 1e-4 {
+			return nil, ErrNotWebMercatorGrid
+		}
+		levels[int64(z)] = lodInfo.LevelID
+	}
+	return levels, nil
+}
+
+// 生成标准Web墨卡托切片方案的切片配置信息，级别号与XYZ级别一致
+func newWebMercatorCacheInfo(minZoom int64, maxZoom int64, format string) conf.CacheInfo {
+	lodInfos := []conf.LODInfo{}
+	for z := minZoom; z <= maxZoom; z++ {
+		lodInfos = append(lodInfos, conf.LODInfo{
+			LevelID:    z,
+			Scale:      webMercatorScale / math.Pow(2, float64(z)),
+			Resolution: webMercatorResolution / math.Pow(2, float64(z)),
+		})
+	}
+	return conf.CacheInfo{
+		TileCacheInfo: conf.TileCacheInfo{
+			SpatialReference: conf.SpatialReference{
+				WKID:       webMercatorWKID,
+				LatestWKID: webMercatorLatestWKID,
+			},
+			TileOrigin: conf.TileOrigin{
+				X: -webMercatorHalfSize,
+				Y: webMercatorHalfSize,
+			},
+			TileCols:   webMercatorTileSize,
+			TileRows:   webMercatorTileSize,
+			DPI:        96,
+			PreciseDPI: 96,
+			LODInfos:   lodInfos,
+		},
+		TileImageInfo: conf.TileImageInfo{
+			CacheTileFormat: format,
+		},
+	}
+}
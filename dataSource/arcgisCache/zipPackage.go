@@ -0,0 +1,113 @@
+package arcgisCache
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	ErrPackageFileNotFound = errors.New("切片包中的文件不存在")
+	ErrCompressedBundle    = errors.New("切片包中的bundle为压缩存储，需以不压缩方式（存储）打包")
+)
+
+// 已打开的切片包数，用于生成每个实例不同的bundle键前缀
+var zipPackageCount uint64
+
+// zipPackage zip格式的切片包（vtpk等），包中的bundle为未压缩存储，可直接按偏移量读取而不需解压
+type zipPackage struct {
+	Path      string
+	keyPrefix string // 包中bundle在文件池中的键前缀。bundle读取的是本实例打开的文件，重新加载或多个服务使用同一个包时不能共用
+	file      *os.File
+	files     map[string]*zip.File // 键为小写的文件路径
+}
+
+// 打开切片包并读取文件目录
+func openZipPackage(path string) (*zipPackage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	reader, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	keyPrefix := fmt.Sprintf("%s#%d/", path, atomic.AddUint64(&zipPackageCount, 1))
+	p := &zipPackage{Path: path, keyPrefix: keyPrefix, file: f, files: make(map[string]*zip.File)}
+	for _, file := range reader.File {
+		p.files[normalizePackagePath(file.Name)] = file
+	}
+	return p, nil
+}
+
+// 包内路径统一为小写、以/分隔，Windows下打包的切片包路径大小写不一
+func normalizePackagePath(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.Replace(name, `\`, "/", -1), "/"))
+}
+
+// 获取包中的文件
+func (p *zipPackage) getFile(name string) (*zip.File, error) {
+	file, ok := p.files[normalizePackagePath(name)]
+	if !ok || file.FileInfo().IsDir() {
+		return nil, ErrPackageFileNotFound
+	}
+	return file, nil
+}
+
+// 读取包中文件的全部内容
+func (p *zipPackage) readFile(name string) ([]byte, error) {
+	file, err := p.getFile(name)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// 打开包中的文件用于随机读取，直接读取切片包中未压缩的文件。
+// 压缩的bundle需整个解压到内存，可达数百MB，不予支持
+func (p *zipPackage) openFile(name string) (bundleReader, os.FileInfo, error) {
+	file, err := p.getFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.Method != zip.Store {
+		return nil, nil, ErrCompressedBundle
+	}
+	offset, err := file.DataOffset()
+	if err != nil {
+		return nil, nil, err
+	}
+	return nopCloserReaderAt{io.NewSectionReader(p.file, offset, int64(file.UncompressedSize64))}, file.FileInfo(), nil
+}
+
+// 关闭切片包，同时移除文件池中本实例的bundle
+func (p *zipPackage) Close() error {
+	bundles.purge(p.keyPrefix)
+	return p.file.Close()
+}
+
+// nopCloserReaderAt 包中的文件，关闭时不关闭切片包
+type nopCloserReaderAt struct {
+	io.ReaderAt
+}
+
+func (nopCloserReaderAt) Close() error {
+	return nil
+}
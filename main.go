@@ -5,30 +5,32 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/BurntSushi/toml"
-	"github.com/gisxiaowei/basemapServer/config"
 	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
 	"github.com/gorilla/mux"
 )
 
-var arcgisCaches = make(map[string]arcgisCache.ArcgisCache)
+// 配置文件路径
+const configPath = "config.toml"
 
 // 请求示例：http://localhost:6081/rest/services/SampleWorldCities10.1/MapServer/tile/0/2/2
 func main() {
-	var config config.Config
-	if _, err := toml.DecodeFile("config.toml", &config); err != nil {
+	config, err := loadConfig(configPath)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	for _, s := range config.Services {
-		// 创建ArcGIS缓存对象
-		arcgisCache, err := arcgisCache.GetArcgisCache(s.Path)
-		if err != nil {
-			log.Fatal(err)
-		}
-		arcgisCaches[s.Name] = arcgisCache
+	// 切片缓存
+	tileCache.setMaxBytes(config.TileCache.MaxBytes)
+	arcgisCache.SetMaxOpenBundles(config.Server.MaxOpenBundles)
+
+	// 加载服务
+	if err := loadServices(config, true); err != nil {
+		log.Fatal(err)
 	}
 
+	// 配置文件修改后重新加载服务，定期重新扫描目录
+	go watchConfig(configPath, config)
+
 	// 路由
 	r := mux.NewRouter()
 	// 静态文件
@@ -37,8 +39,48 @@ func main() {
 	// {_:[/]?}表示/可以重复任意次
 	r.HandleFunc("/", RootHandler)
 	r.HandleFunc("/rest/services{_:[/]?}", ServicesDirectoryHandler)
-	r.HandleFunc("/rest/services/{name}/MapServer{_:[/]?}", ArcgisCacheMapServerHandler)
-	r.HandleFunc("/rest/services/{name}/MapServer/tile/{level:[0-9]+}/{row:[0-9]+}/{col:[0-9]+}", ArcgisCacheTileHandler)
+	// 全部服务的WMS
+	r.HandleFunc("/wms{_:[/]?}", WMSServicesHandler)
+	r.HandleFunc("/rest/services/{folder}{_:[/]?}", ServicesDirectoryHandler)
+	// 根目录和文件夹下的服务
+	for _, prefix := range []string{"/rest/services/{name}/MapServer", "/rest/services/{folder}/{name}/MapServer"} {
+		r.HandleFunc(prefix+"{_:[/]?}", ArcgisCacheMapServerHandler)
+		r.HandleFunc(prefix+"/tile/{level:[0-9]+}/{row:[0-9]+}/{col:[0-9]+}", ArcgisCacheTileHandler)
+		r.HandleFunc(prefix+"/tilemap/{level:[0-9]+}/{row:[0-9]+}/{col:[0-9]+}/{width:[0-9]+}/{height:[0-9]+}", TileMapHandler)
+		r.HandleFunc(prefix+"/export{_:[/]?}", ExportHandler)
+		r.HandleFunc(prefix+"/WMSServer{_:[/]?}", WMSHandler)
+		// WMTS
+		r.HandleFunc(prefix+"/WMTS{_:[/]?}", WMTSHandler)
+		r.HandleFunc(prefix+"/WMTS/1.0.0/WMTSCapabilities.xml", WMTSCapabilitiesHandler)
+		r.HandleFunc(prefix+"/WMTS/tile/1.0.0/{layer}/{style}/{tileMatrixSet}/{tileMatrix}/{row:[0-9]+}/{col:[0-9]+}", WMTSTileHandler)
+		// XYZ、TMS、quadkey，扩展名可省略
+		r.HandleFunc(prefix+"/xyz/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}{ext:(?:\\.[a-z]+)?}", XYZTileHandler)
+		r.HandleFunc(prefix+"/tms/tilemapresource.xml", TMSTileMapResourceHandler)
+		r.HandleFunc(prefix+"/tms/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}{ext:(?:\\.[a-z]+)?}", TMSTileHandler)
+		r.HandleFunc(prefix+"/quadkey/{quadkey:[0-3]+}{ext:(?:\\.[a-z]+)?}", QuadkeyTileHandler)
+		// 百度切片
+		r.HandleFunc(prefix+"/baidu/{z:[0-9]+}/{x:-?[0-9]+}/{y:-?[0-9]+}{ext:(?:\\.[a-z]+)?}", BaiduTileHandler)
+		// 天地图兼容接口
+		r.HandleFunc(prefix+"/tianditu/{layer:[a-z]+}_{tileMatrixSet:[cw]}/wmts", TiandituWMTSHandler)
+		r.HandleFunc(prefix+"/tianditu/wmts", TiandituWMTSHandler)
+		r.HandleFunc(prefix+"/tianditu/DataServer", TiandituDataServerHandler)
+		// TileJSON
+		r.HandleFunc(prefix+"/tilejson{_:[/]?}", TileJSONHandler)
+	}
+	// 矢量切片服务
+	for _, prefix := range []string{"/rest/services/{name}/VectorTileServer", "/rest/services/{folder}/{name}/VectorTileServer"} {
+		r.HandleFunc(prefix+"{_:[/]?}", VectorTileServerHandler)
+		r.HandleFunc(prefix+"/tile/{level:[0-9]+}/{row:[0-9]+}/{col:[0-9]+}.pbf", VectorTileHandler)
+		r.HandleFunc(prefix+"/tilemap/{level:[0-9]+}/{row:[0-9]+}/{col:[0-9]+}/{width:[0-9]+}/{height:[0-9]+}", VectorTileMapHandler)
+		r.HandleFunc(prefix+"/resources/{resource:.+}", VectorTileResourceHandler)
+	}
+	// 管理接口
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminAuthMiddleware)
+	admin.HandleFunc("/services{_:[/]?}", AdminServicesHandler)
+	admin.HandleFunc("/services/{name}", AdminServiceHandler)
+	admin.HandleFunc("/services/{folder}/{name}", AdminServiceHandler)
+	admin.HandleFunc("/tileCache{_:[/]?}", AdminTileCacheHandler)
 
 	// 运行
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", config.Server.Port), r))
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gisxiaowei/basemapServer/config"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+var (
+	ErrInvalidServiceName    = errors.New("无效的服务名")
+	ErrInvalidFolderName     = errors.New("无效的文件夹名")
+	ErrUnsupportVectorOption = errors.New("矢量切片包不支持重投影和纠偏")
+)
+
+// 服务类型
+const (
+	serviceTypeMapServer        = "MapServer"
+	serviceTypeVectorTileServer = "VectorTileServer"
+)
+
+// 服务注册表
+var services = newServiceRegistry()
+
+// 服务编号，每次加载服务时递增
+var lastServiceID uint64
+
+// serviceEntry 已加载的服务
+type serviceEntry struct {
+	Config            config.Service
+	Metadata          arcgisCache.Metadata           // 配置中的服务元数据
+	ArcgisCache       arcgisCache.ArcgisCache        // 栅格切片缓存，矢量切片服务为nil
+	VectorTile        *arcgisCache.VectorTilePackage // 矢量切片包，栅格切片服务为nil
+	MissingTilePolicy missingTilePolicy
+
+	id        uint64 // 服务编号，用于切片缓存
+	refs      int64  // 正在使用该服务的请求数
+	retired   int32  // 是否已从注册表中移除
+	closeOnce sync.Once
+}
+
+// 服务类型：MapServer或VectorTileServer
+func (s *serviceEntry) serviceType() string {
+	if s.VectorTile != nil {
+		return serviceTypeVectorTileServer
+	}
+	return serviceTypeMapServer
+}
+
+// 释放服务，已移除的服务在最后一个请求结束后关闭
+func (s *serviceEntry) release() {
+	if atomic.AddInt64(&s.refs, -1) == 0 && atomic.LoadInt32(&s.retired) == 1 {
+		s.close()
+	}
+}
+
+// 从注册表中移除服务并清除其切片缓存，没有请求在使用时立即关闭
+func (s *serviceEntry) retire() {
+	atomic.StoreInt32(&s.retired, 1)
+	tileCache.purge(s.id)
+	if atomic.LoadInt64(&s.refs) == 0 {
+		s.close()
+	}
+}
+
+// 关闭服务。关闭时服务已移除且没有请求在使用，删除切片缓存中的移除记录
+func (s *serviceEntry) close() {
+	s.closeOnce.Do(func() {
+		tileCache.forget(s.id)
+		var err error
+		if s.VectorTile != nil {
+			err = s.VectorTile.Close()
+		} else {
+			err = s.ArcgisCache.Close()
+		}
+		if err != nil {
+			log.Printf("关闭服务%s出错：%v", s.Config.QualifiedName(), err)
+		}
+	})
+}
+
+// serviceRegistry 服务注册表，可在运行时整体替换
+type serviceRegistry struct {
+	mu       sync.RWMutex
+	loadMu   sync.Mutex // 保证同一时间只有一次加载
+	services map[string]*serviceEntry
+	config   config.Config // 最近一次加载的配置
+}
+
+// 创建服务注册表
+func newServiceRegistry() *serviceRegistry {
+	return &serviceRegistry{services: make(map[string]*serviceEntry)}
+}
+
+// 记录最近一次加载的配置
+func (r *serviceRegistry) setConfig(c config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = c
+}
+
+// 获取最近一次加载的配置
+func (r *serviceRegistry) getConfig() config.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// 获取MapServer服务，name为带文件夹的服务名，使用完毕后需调用release
+func (r *serviceRegistry) acquire(name string) (*serviceEntry, bool) {
+	return r.acquireType(name, serviceTypeMapServer)
+}
+
+// 获取VectorTileServer服务，使用完毕后需调用release
+func (r *serviceRegistry) acquireVectorTile(name string) (*serviceEntry, bool) {
+	return r.acquireType(name, serviceTypeVectorTileServer)
+}
+
+// 获取指定类型的服务，服务不存在或类型不同时ok为false
+func (r *serviceRegistry) acquireType(name string, serviceType string) (*serviceEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.services[name]
+	if !ok || s.serviceType() != serviceType {
+		return nil, false
+	}
+	atomic.AddInt64(&s.refs, 1)
+	return s, true
+}
+
+// 获取全部MapServer服务，按带文件夹的服务名排序，使用完毕后需对每个服务调用release
+func (r *serviceRegistry) acquireAll() []*serviceEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.services))
+	for name, s := range r.services {
+		if s.serviceType() == serviceTypeMapServer {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	entries := make([]*serviceEntry, 0, len(names))
+	for _, name := range names {
+		s := r.services[name]
+		atomic.AddInt64(&s.refs, 1)
+		entries = append(entries, s)
+	}
+	return entries
+}
+
+// 获取目录下的子文件夹和服务（名称带文件夹），按名称排序。folder为空时为根目录，文件夹不存在时ok为false
+func (r *serviceRegistry) directory(folder string) (folders []string, entries []service.Service, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	folders = []string{}
+	entries = []service.Service{}
+	seen := make(map[string]bool)
+	for name, s := range r.services {
+		if s.Config.Folder == folder {
+			entries = append(entries, service.Service{Name: name, Type: s.serviceType()})
+		} else if folder == "" && !seen[s.Config.Folder] {
+			seen[s.Config.Folder] = true
+			folders = append(folders, s.Config.Folder)
+		}
+	}
+	sort.Strings(folders)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return folders, entries, folder == "" || len(entries) > 0
+}
+
+// 根据配置加载服务：打开新增和修改的服务，关闭移除的服务，配置未变的服务保持不变。
+// 加载失败的服务保留原有版本（如有），服务名重复时只加载第一个，返回第一个错误
+func (r *serviceRegistry) load(configs []config.Service) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	var firstErr error
+	r.mu.RLock()
+	old := r.services
+	r.mu.RUnlock()
+
+	services := make(map[string]*serviceEntry)
+	loaded := make(map[string]bool)
+	for _, c := range configs {
+		name := c.QualifiedName()
+		// 后出现的同名服务不打开，否则会覆盖前一个且前一个无法关闭
+		if loaded[name] {
+			log.Printf("服务%s重复，已忽略路径为%s的服务", name, c.Path)
+			continue
+		}
+		loaded[name] = true
+
+		if s, ok := old[name]; ok && s.Config == c {
+			services[name] = s
+			continue
+		}
+
+		s, err := openService(c)
+		if err != nil {
+			log.Printf("加载服务%s出错：%v", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			// 保留原有服务
+			if s, ok := old[name]; ok {
+				services[name] = s
+			}
+			continue
+		}
+		services[name] = s
+		log.Printf("已加载服务%s", name)
+	}
+
+	r.mu.Lock()
+	retired := r.services
+	r.services = services
+	r.mu.Unlock()
+
+	// 关闭已移除或已替换的服务
+	for name, s := range retired {
+		if services[name] != s {
+			s.retire()
+			if _, ok := services[name]; !ok {
+				log.Printf("已移除服务%s", name)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// 根据配置打开服务
+func openService(c config.Service) (*serviceEntry, error) {
+	if err := validateServiceName(c); err != nil {
+		return nil, err
+	}
+
+	// 矢量切片包
+	if arcgisCache.IsVectorTilePackage(c.Path) {
+		return openVectorTileService(c)
+	}
+
+	// 创建ArcGIS缓存对象
+	cache, err := arcgisCache.GetArcgisCache(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 重投影、纠偏
+	if c.Reproject != "" || c.DatumShift != "" {
+		reprojector, err := arcgisCache.NewReprojector(cache, c.Reproject, c.DatumShift, c.Resampling)
+		if err != nil {
+			cache.Close()
+			return nil, err
+		}
+		cache = reprojector
+	}
+
+	// 缺失切片处理策略
+	policy, err := newMissingTilePolicy(c)
+	if err != nil {
+		cache.Close()
+		return nil, err
+	}
+
+	return &serviceEntry{
+		id:                atomic.AddUint64(&lastServiceID, 1),
+		Config:            c,
+		Metadata:          getCacheMetadata(c.Metadata),
+		ArcgisCache:       cache,
+		MissingTilePolicy: policy,
+	}, nil
+}
+
+// 根据配置打开矢量切片服务，缺失的切片总是返回404
+func openVectorTileService(c config.Service) (*serviceEntry, error) {
+	if c.Reproject != "" || c.DatumShift != "" {
+		return nil, ErrUnsupportVectorOption
+	}
+	vectorTile, err := arcgisCache.NewVectorTilePackage(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &serviceEntry{
+		id:         atomic.AddUint64(&lastServiceID, 1),
+		Config:     c,
+		Metadata:   getCacheMetadata(c.Metadata),
+		VectorTile: &vectorTile,
+	}, nil
+}
+
+// 将配置中的服务元数据转为缓存使用的元数据
+func getCacheMetadata(m config.Metadata) arcgisCache.Metadata {
+	return arcgisCache.Metadata{
+		Description:   m.Description,
+		CopyrightText: m.CopyrightText,
+		Capabilities:  m.Capabilities,
+		InitialExtent: arcgisCache.Extent{
+			XMin: m.InitialExtent.XMin,
+			YMin: m.InitialExtent.YMin,
+			XMax: m.InitialExtent.XMax,
+			YMax: m.InitialExtent.YMax,
+		},
+		DocumentInfo: arcgisCache.DocumentInfo{
+			Title:    m.DocumentInfo.Title,
+			Author:   m.DocumentInfo.Author,
+			Comments: m.DocumentInfo.Comments,
+			Subject:  m.DocumentInfo.Subject,
+			Category: m.DocumentInfo.Category,
+			Keywords: m.DocumentInfo.Keywords,
+		},
+	}
+}
+
+// 校验服务名和文件夹名，文件夹只有一级
+func validateServiceName(c config.Service) error {
+	if c.Name == "" || strings.ContainsAny(c.Name, `/\?#`) {
+		return ErrInvalidServiceName
+	}
+	if strings.ContainsAny(c.Folder, `/\?#`) {
+		return ErrInvalidFolderName
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gisxiaowei/basemapServer/config"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+)
+
+// 配置文件检查间隔
+const configWatchInterval = 2 * time.Second
+
+// 读取配置文件
+func loadConfig(path string) (config.Config, error) {
+	var c config.Config
+	_, err := toml.DecodeFile(path, &c)
+	return c, err
+}
+
+// 重新加载配置文件中的服务并重新扫描目录，读取配置文件出错时返回false
+func reloadConfig(path string) (config.Config, bool) {
+	c, err := loadConfig(path)
+	if err != nil {
+		log.Printf("读取配置文件出错：%v", err)
+		return c, false
+	}
+	tileCache.setMaxBytes(c.TileCache.MaxBytes)
+	arcgisCache.SetMaxOpenBundles(c.Server.MaxOpenBundles)
+	loadServices(c, true)
+	return c, true
+}
+
+// 监视配置文件的修改和SIGHUP信号，重新加载服务，并定期重新扫描目录。c为当前配置
+func watchConfig(path string, c config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	modTime := getModTime(path)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+			log.Println("收到SIGHUP，重新加载配置")
+			modTime = getModTime(path)
+			if newConfig, ok := reloadConfig(path); ok {
+				c = newConfig
+			}
+		case <-ticker.C:
+			t := getModTime(path)
+			if t.Equal(modTime) {
+				rescanCatalogs(c)
+				continue
+			}
+			modTime = t
+			log.Println("配置文件已修改，重新加载配置")
+			if newConfig, ok := reloadConfig(path); ok {
+				c = newConfig
+			}
+		}
+	}
+}
+
+// 获取文件修改时间，文件不存在时返回零值
+func getModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
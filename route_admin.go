@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gisxiaowei/basemapServer/config"
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+var (
+	ErrServiceExists   = errors.New("服务已存在")
+	ErrServiceNotFound = errors.New("服务不存在")
+)
+
+// 管理接口修改配置文件时加锁
+var adminMu sync.Mutex
+
+// AdminAuthMiddleware 管理接口鉴权，请求头需携带 Authorization: Bearer <token>。
+// 令牌取最近一次加载的配置，修改配置文件后随配置重新加载生效
+func AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 未配置令牌时不启用管理接口
+		token := services.getConfig().Admin.Token
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "未授权")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminServicesHandler 服务列表（GET）、新建服务（POST）
+func AdminServicesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c, err := loadConfig(configPath)
+		if err != nil {
+			log.Println(err)
+			writeAdminError(w, http.StatusInternalServerError, "读取配置文件出错")
+			return
+		}
+		services := c.Services
+		if services == nil {
+			services = []config.Service{}
+		}
+		writeAdminJSON(w, http.StatusOK, services)
+	case http.MethodPost:
+		s, ok := readAdminService(w, r)
+		if !ok {
+			return
+		}
+		if isDryRun(r) {
+			validateAdminService(w, s)
+			return
+		}
+		updateAdminServices(w, http.StatusCreated, s, func(services []config.Service) ([]config.Service, error) {
+			if findService(services, s.QualifiedName()) >= 0 {
+				return nil, ErrServiceExists
+			}
+			return append(services, s), nil
+		})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAdminError(w, http.StatusMethodNotAllowed, "不支持此方法")
+	}
+}
+
+// AdminServiceHandler 查询（GET）、修改（PUT）、删除（DELETE）服务
+func AdminServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := getServiceName(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		c, err := loadConfig(configPath)
+		if err != nil {
+			log.Println(err)
+			writeAdminError(w, http.StatusInternalServerError, "读取配置文件出错")
+			return
+		}
+		i := findService(c.Services, name)
+		if i < 0 {
+			writeAdminError(w, http.StatusNotFound, ErrServiceNotFound.Error())
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, c.Services[i])
+	case http.MethodPut:
+		s, ok := readAdminService(w, r)
+		if !ok {
+			return
+		}
+		if s.QualifiedName() != name {
+			writeAdminError(w, http.StatusBadRequest, "服务名与地址不一致")
+			return
+		}
+		if isDryRun(r) {
+			validateAdminService(w, s)
+			return
+		}
+		updateAdminServices(w, http.StatusOK, s, func(services []config.Service) ([]config.Service, error) {
+			i := findService(services, name)
+			if i < 0 {
+				return nil, ErrServiceNotFound
+			}
+			services[i] = s
+			return services, nil
+		})
+	case http.MethodDelete:
+		updateAdminServices(w, http.StatusNoContent, config.Service{}, func(services []config.Service) ([]config.Service, error) {
+			i := findService(services, name)
+			if i < 0 {
+				return nil, ErrServiceNotFound
+			}
+			return append(services[:i], services[i+1:]...), nil
+		})
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeAdminError(w, http.StatusMethodNotAllowed, "不支持此方法")
+	}
+}
+
+// AdminTileCacheHandler 切片缓存统计（GET）、清空切片缓存（DELETE）
+func AdminTileCacheHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, tileCache.stats())
+	case http.MethodDelete:
+		tileCache.clear()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeAdminError(w, http.StatusMethodNotAllowed, "不支持此方法")
+	}
+}
+
+// 读取请求体中的服务配置
+func readAdminService(w http.ResponseWriter, r *http.Request) (config.Service, bool) {
+	var s config.Service
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "无效的请求体："+err.Error())
+		return s, false
+	}
+	s.Name = strings.TrimSpace(s.Name)
+	s.Folder = strings.TrimSpace(s.Folder)
+	s.Path = strings.TrimSpace(s.Path)
+	if err := validateServiceName(s); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return s, false
+	}
+	return s, true
+}
+
+// 仅校验服务配置，不保存
+func validateAdminService(w http.ResponseWriter, s config.Service) {
+	entry, err := openService(s)
+	if err != nil {
+		writeAdminError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	entry.close()
+	writeAdminJSON(w, http.StatusOK, s)
+}
+
+// 校验服务配置，修改服务列表并写回配置文件，然后重新加载服务
+func updateAdminServices(w http.ResponseWriter, code int, s config.Service, update func([]config.Service) ([]config.Service, error)) {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	// 校验新的服务配置
+	if s.Name != "" {
+		entry, err := openService(s)
+		if err != nil {
+			writeAdminError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		entry.close()
+	}
+
+	c, err := loadConfig(configPath)
+	if err != nil {
+		log.Println(err)
+		writeAdminError(w, http.StatusInternalServerError, "读取配置文件出错")
+		return
+	}
+	c.Services, err = update(c.Services)
+	if err == ErrServiceExists {
+		writeAdminError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == ErrServiceNotFound {
+		writeAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := saveConfig(configPath, c); err != nil {
+		log.Println(err)
+		writeAdminError(w, http.StatusInternalServerError, "保存配置文件出错")
+		return
+	}
+	loadServices(c, false)
+
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return
+	}
+	writeAdminJSON(w, code, s)
+}
+
+// 保存配置文件，先写入临时文件并同步到磁盘再替换，保留原文件的权限。
+// 配置重新编码后写入，原文件中的注释和格式不会保留
+func saveConfig(path string, c config.Config) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = toml.NewEncoder(f).Encode(c)
+	if info, statErr := os.Stat(path); err == nil && statErr == nil {
+		err = f.Chmod(info.Mode())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// 根据带文件夹的服务名查找服务，不存在时返回-1
+func findService(services []config.Service, name string) int {
+	for i, s := range services {
+		if s.QualifiedName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 是否仅校验
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// 输出json
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(jsonBytes)
+}
+
+// 输出json格式的错误
+func writeAdminError(w http.ResponseWriter, code int, message string) {
+	writeAdminJSON(w, code, service.ErrorResponse{
+		Error: service.Error{Message: message, Code: code, Details: []string{}},
+	})
+}
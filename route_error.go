@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+// 获取请求的输出格式
+func getFormat(r *http.Request) string {
+	return strings.TrimSpace(strings.ToLower(r.URL.Query().Get("f")))
+}
+
+// JSONP回调函数名只允许标识符和点号，防止注入脚本
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.]*$`)
+
+// 输出json字符串，请求中有callback参数时输出JSONP
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, jsonStr string) {
+	// callback
+	callback := strings.TrimSpace(r.URL.Query().Get("callback"))
+	if callback != "" {
+		if !callbackPattern.MatchString(callback) {
+			http.Error(w, "callback参数无效", http.StatusBadRequest)
+			return
+		}
+		jsonStr = fmt.Sprintf(`%s(%s);`, callback, jsonStr)
+		// JSONP通过script标签加载，非200状态码会导致回调无法执行
+		code = http.StatusOK
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(code)
+	w.Write([]byte(jsonStr))
+}
+
+// 输出错误：f=json或pjson时输出ArcGIS REST格式的json，否则输出html错误页面
+func writeError(w http.ResponseWriter, r *http.Request, code int, message string, details ...string) {
+	if details == nil {
+		details = []string{}
+	}
+	serviceError := service.Error{Message: message, Code: code, Details: details}
+
+	f := getFormat(r)
+	if f == "json" || f == "pjson" {
+		var jsonBytes []byte
+		var err error
+		if f == "pjson" {
+			jsonBytes, err = json.MarshalIndent(service.ErrorResponse{Error: serviceError}, "", "  ")
+		} else {
+			jsonBytes, err = json.Marshal(service.ErrorResponse{Error: serviceError})
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, message, code)
+			return
+		}
+		writeJSON(w, r, code, string(jsonBytes))
+		return
+	}
+
+	var buf bytes.Buffer
+	templates, err := template.ParseFiles("templates/error.html")
+	if err == nil {
+		err = templates.ExecuteTemplate(&buf, "error", serviceError)
+	}
+	if err != nil {
+		log.Println("模板出错", err)
+		http.Error(w, message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// 渲染html模板，出错时输出错误
+func writeTemplate(w http.ResponseWriter, r *http.Request, file string, name string, data interface{}) {
+	var buf bytes.Buffer
+	templates, err := template.ParseFiles(file)
+	if err == nil {
+		err = templates.ExecuteTemplate(&buf, name, data)
+	}
+	if err != nil {
+		log.Println("模板出错", err)
+		writeError(w, r, http.StatusInternalServerError, "模板出错", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+// 导出图片的最大宽高，与MapServer的maxImageWidth、maxImageHeight一致
+const maxExportSize = 2048
+
+// ExportHandler 导出地图处理函数，拼接缓存切片生成指定范围的图片，f=image时输出图片，否则输出包含图片地址的json
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		query := r.URL.Query()
+		cacheSR := s.ArcgisCache.GetCacheInfo().TileCacheInfo.SpatialReference
+
+		// 范围
+		bbox, ok := parseBBox(query.Get("bbox"))
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "无效的参数", "bbox格式为xmin,ymin,xmax,ymax")
+			return
+		}
+
+		// 图片大小
+		width, height := 400, 400
+		if size := strings.TrimSpace(query.Get("size")); size != "" {
+			parts := strings.Split(size, ",")
+			var err1, err2 error
+			if len(parts) == 2 {
+				width, err1 = strconv.Atoi(strings.TrimSpace(parts[0]))
+				height, err2 = strconv.Atoi(strings.TrimSpace(parts[1]))
+			}
+			if len(parts) != 2 || err1 != nil || err2 != nil {
+				writeError(w, r, http.StatusBadRequest, "无效的参数", "size格式为width,height")
+				return
+			}
+		}
+		if width <= 0 || height <= 0 || width > maxExportSize || height > maxExportSize {
+			writeError(w, r, http.StatusBadRequest, "无效的参数", fmt.Sprintf("图片宽高须在1~%d之间", maxExportSize))
+			return
+		}
+
+		// dpi只用于计算json中的比例尺，级别按输出图片的像素分辨率选取，与dpi无关
+		dpi := 96.0
+		if value := strings.TrimSpace(query.Get("dpi")); value != "" {
+			var err error
+			if dpi, err = strconv.ParseFloat(value, 64); err != nil || dpi <= 0 {
+				writeError(w, r, http.StatusBadRequest, "无效的参数", "dpi须为正数")
+				return
+			}
+		}
+		transparent := strings.EqualFold(strings.TrimSpace(query.Get("transparent")), "true")
+		format, ok := getExportImageFormat(query.Get("format"), transparent)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "不支持的图片格式", query.Get("format"))
+			return
+		}
+
+		// 坐标系：bboxSR默认为缓存的坐标系，imageSR默认为bboxSR
+		bboxSR := cacheSR
+		if value := strings.TrimSpace(query.Get("bboxSR")); value != "" {
+			sr, err := arcgisCache.ParseSpatialReference(value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "无效的参数", "bboxSR："+err.Error())
+				return
+			}
+			bboxSR = sr
+		}
+		imageSR := bboxSR
+		if value := strings.TrimSpace(query.Get("imageSR")); value != "" {
+			sr, err := arcgisCache.ParseSpatialReference(value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "无效的参数", "imageSR："+err.Error())
+				return
+			}
+			imageSR = sr
+		}
+
+		// 范围转为输出坐标系，并按图片宽高比扩展
+		toImage, err := arcgisCache.GetTransform(bboxSR, imageSR)
+		if err == nil {
+			_, err = arcgisCache.GetTransform(imageSR, cacheSR)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "不支持的坐标系", err.Error())
+			return
+		}
+		bbox = transformBBox(bbox, toImage)
+		bbox = fitBBox(bbox, width, height)
+
+		if getFormat(r) != "image" {
+			writeExportJSON(w, r, s, bbox, width, height, dpi, imageSR)
+			return
+		}
+
+		img, err := renderMap(s, bbox, width, height, imageSR)
+		if err == arcgisCache.ErrLevelOutOfRange || err == arcgisCache.ErrTooManyTiles {
+			// 缓存没有与输出分辨率相近的级别，输出空白图片会被误认为范围内没有数据
+			writeError(w, r, http.StatusBadRequest, "无效的参数", "bbox和size对应的比例尺超出缓存级别范围")
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			writeError(w, r, http.StatusInternalServerError, "导出地图出错", err.Error())
+			return
+		}
+		if !transparent {
+			img = withBackground(img, color.White)
+		}
+		writeMapImage(w, img, format)
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// 输出导出结果的json，href为f=image的导出地址
+func writeExportJSON(w http.ResponseWriter, r *http.Request, s *serviceEntry, bbox [4]float64, width int, height int, dpi float64, imageSR conf.SpatialReference) {
+	query := r.URL.Query()
+	query.Set("f", "image")
+	query.Del("callback")
+	resolution := (bbox[2] - bbox[0]) / float64(width)
+	exportImage := service.ExportImage{
+		Href:   fmt.Sprintf("%s%s?%s", getBaseURL(r), r.URL.Path, query.Encode()),
+		Width:  width,
+		Height: height,
+		Extent: service.Extent{
+			XMin:             bbox[0],
+			YMin:             bbox[1],
+			XMax:             bbox[2],
+			YMax:             bbox[3],
+			SpatialReference: arcgisCache.GetServiceSpatialReference(imageSR),
+		},
+		Scale: resolution * arcgisCache.MetersPerUnit(imageSR) * dpi / 0.0254,
+	}
+
+	var jsonBytes []byte
+	var err error
+	if getFormat(r) == "pjson" {
+		jsonBytes, err = json.MarshalIndent(exportImage, "", "  ")
+	} else {
+		jsonBytes, err = json.Marshal(exportImage)
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusInternalServerError, "导出地图出错", err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, string(jsonBytes))
+}
+
+// 拼接服务的缓存切片生成图片，bbox为imageSR坐标系下的范围
+func renderMap(s *serviceEntry, bbox [4]float64, width int, height int, imageSR conf.SpatialReference) (*image.NRGBA, error) {
+	toCache, err := arcgisCache.GetTransform(imageSR, s.ArcgisCache.GetCacheInfo().TileCacheInfo.SpatialReference)
+	if err != nil {
+		return nil, err
+	}
+	resampling := strings.ToLower(strings.TrimSpace(s.Config.Resampling))
+	img, _, err := arcgisCache.RenderImage(s.ArcgisCache, bbox[0], bbox[1], bbox[2], bbox[3], width, height, toCache, resampling)
+	return img, err
+}
+
+// 将图片绘制到纯色背景上
+func withBackground(img *image.NRGBA, background color.Color) *image.NRGBA {
+	dst := image.NewNRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// 编码并输出地图图片
+func writeMapImage(w http.ResponseWriter, img image.Image, format string) {
+	data, err := arcgisCache.EncodeImage(img, format, 0)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/"+format)
+	w.Write(data)
+}
+
+// 获取导出图片格式，jpgpng透明时为PNG，否则为JPEG
+func getExportImageFormat(value string, transparent bool) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "png", "png8", "png24", "png32":
+		return arcgisCache.TileFormatPNG, true
+	case "jpg", "jpeg":
+		return arcgisCache.TileFormatJPEG, true
+	case "jpgpng":
+		if transparent {
+			return arcgisCache.TileFormatPNG, true
+		}
+		return arcgisCache.TileFormatJPEG, true
+	case "gif":
+		return arcgisCache.TileFormatGIF, true
+	case "bmp":
+		return arcgisCache.TileFormatBMP, true
+	case "tiff", "tif":
+		return arcgisCache.TileFormatTIFF, true
+	}
+	return "", false
+}
+
+// 解析范围xmin,ymin,xmax,ymax
+func parseBBox(value string) ([4]float64, bool) {
+	var bbox [4]float64
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return bbox, false
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return bbox, false
+		}
+		bbox[i] = v
+	}
+	return bbox, bbox[2] > bbox[0] && bbox[3] > bbox[1]
+}
+
+// 转换范围的坐标系，取四个角点转换后的外接矩形
+func transformBBox(bbox [4]float64, transform func(float64, float64) (float64, float64)) [4]float64 {
+	result := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, corner := range [][2]float64{{bbox[0], bbox[1]}, {bbox[0], bbox[3]}, {bbox[2], bbox[1]}, {bbox[2], bbox[3]}} {
+		x, y := transform(corner[0], corner[1])
+		result[0], result[1] = math.Min(result[0], x), math.Min(result[1], y)
+		result[2], result[3] = math.Max(result[2], x), math.Max(result[3], y)
+	}
+	return result
+}
+
+// 按图片宽高比以中心为基准扩展范围，与ArcGIS的export一致
+func fitBBox(bbox [4]float64, width int, height int) [4]float64 {
+	cx, cy := (bbox[0]+bbox[2])/2, (bbox[1]+bbox[3])/2
+	resolution := math.Max((bbox[2]-bbox[0])/float64(width), (bbox[3]-bbox[1])/float64(height))
+	halfWidth, halfHeight := resolution*float64(width)/2, resolution*float64(height)/2
+	return [4]float64{cx - halfWidth, cy - halfHeight, cx + halfWidth, cy + halfHeight}
+}
@@ -3,13 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
-	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
 	"github.com/gisxiaowei/basemapServer/service"
 	"github.com/gorilla/mux"
 )
@@ -19,58 +16,51 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/rest/services", http.StatusFound)
 }
 
+// servicesDirectoryData 服务目录模板数据
+type servicesDirectoryData struct {
+	Folder   string            // 当前文件夹，为空时为根目录
+	Folders  []string          // 子文件夹
+	Services []service.Service // 服务，名称带文件夹
+}
+
 // ServicesDirectoryHandler 服务目录处理函数
 func ServicesDirectoryHandler(w http.ResponseWriter, r *http.Request) {
-	// query
-	query := r.URL.Query()
+	// 文件夹
+	folder := mux.Vars(r)["folder"]
+	folders, entries, ok := services.directory(folder)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "文件夹不存在", fmt.Sprintf("文件夹%s不存在", folder))
+		return
+	}
 
 	// format
-	f := strings.TrimSpace(strings.ToLower(query.Get("f")))
+	f := getFormat(r)
 	if f == "" || f == "html" { // html
-		templates := template.Must(template.ParseFiles("templates/servicesDirectory.html"))
-		err := templates.ExecuteTemplate(w, "servicesDirectory", arcgisCaches)
-		if err != nil {
-			log.Fatalln("模板出错", err)
-		}
+		writeTemplate(w, r, "templates/servicesDirectory.html", "servicesDirectory", servicesDirectoryData{
+			Folder:   folder,
+			Folders:  folders,
+			Services: entries,
+		})
 	} else if f == "json" || f == "pjson" { // json
 		pretty := f == "pjson"
-		jsonStr, err := getServicesDirectoryJSONString(arcgisCaches, pretty)
+		jsonStr, err := getServicesDirectoryJSONString(folders, entries, pretty)
 		if err != nil {
-			log.Fatal(err)
-		}
-
-		// callback
-		callback := query.Get("callback")
-		callback = strings.TrimSpace(callback)
-		if callback != "" {
-			jsonStr = fmt.Sprintf(`%s(%s);`, callback, jsonStr)
+			log.Println(err)
+			writeError(w, r, http.StatusInternalServerError, "获取服务目录出错", err.Error())
+			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(jsonStr))
+		writeJSON(w, r, http.StatusOK, jsonStr)
 	} else {
-		w.WriteHeader(400)
-		templates := template.Must(template.ParseFiles("templates/error.html"))
-		err := templates.ExecuteTemplate(w, "error", service.Error{Message: "不支持此格式", Code: 400})
-		if err != nil {
-			log.Fatalln("模板出错", err)
-		}
+		writeError(w, r, http.StatusBadRequest, "不支持此格式")
 	}
 }
 
 // 获取服务目录对象json字符串
-func getServicesDirectoryJSONString(arcgisCaches map[string]arcgisCache.ArcgisCache, pretty bool) (string, error) {
-	services := []service.Service{}
-	for key := range arcgisCaches {
-		services = append(services, service.Service{
-			Name: key,
-			Type: "MapServer",
-		})
-	}
+func getServicesDirectoryJSONString(folders []string, entries []service.Service, pretty bool) (string, error) {
 	servicesDirectory := service.ServicesDirectory{
 		CurrentVersion: 10.11,
-		Folders:        []interface{}{},
-		Services:       services,
+		Folders:        folders,
+		Services:       entries,
 	}
 
 	// 转为json
@@ -91,57 +81,33 @@ func getServicesDirectoryJSONString(arcgisCaches map[string]arcgisCache.ArcgisCa
 
 // ArcgisCacheMapServerHandler MapServer处理函数
 func ArcgisCacheMapServerHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
 	// 服务名
-	name, _ := vars["name"]
-	if _, ok := arcgisCaches[name]; ok {
-		arcgisCache := arcgisCaches[name]
-
-		// query
-		query := r.URL.Query()
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		arcgisCache := s.ArcgisCache
 
 		// format
-		f := strings.TrimSpace(strings.ToLower(query.Get("f")))
+		f := getFormat(r)
 		if f == "" || f == "html" { // html
-			templates := template.Must(template.ParseFiles("templates/mapServer.html"))
-			err := templates.ExecuteTemplate(w, "mapServer", name)
-			if err != nil {
-				log.Fatalln("模板出错", err)
-			}
+			writeTemplate(w, r, "templates/mapServer.html", "mapServer", name)
 		} else if f == "json" || f == "pjson" { // json
 			pretty := f == "pjson"
-			jsonStr, err := arcgisCache.GetMapServerJSONString(pretty)
+			jsonStr, err := arcgisCache.GetMapServerJSONString(s.Metadata, pretty)
 			if err != nil {
-				log.Fatal(err)
-			}
-
-			// callback
-			callback := query.Get("callback")
-			callback = strings.TrimSpace(callback)
-			if callback != "" {
-				jsonStr = fmt.Sprintf(`%s(%s);`, callback, jsonStr)
+				log.Println(err)
+				writeError(w, r, http.StatusInternalServerError, "获取服务信息出错", err.Error())
+				return
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(jsonStr))
+			writeJSON(w, r, http.StatusOK, jsonStr)
 		} else if f == "jsapi" { // jsapi
-			templates := template.Must(template.ParseFiles("templates/jsapi.html"))
-			err := templates.ExecuteTemplate(w, "jsapi", name)
-			if err != nil {
-				log.Fatalln("模板出错", err)
-			}
+			writeTemplate(w, r, "templates/jsapi.html", "jsapi", name)
 		} else {
-			w.WriteHeader(400)
-			templates := template.Must(template.ParseFiles("templates/error.html"))
-			err := templates.ExecuteTemplate(w, "error", service.Error{Message: "不支持此格式", Code: 400})
-			if err != nil {
-				log.Fatalln("模板出错", err)
-			}
+			writeError(w, r, http.StatusBadRequest, "不支持此格式")
 		}
 
 	} else {
-		http.NotFound(w, r)
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
 	}
 }
 
@@ -150,19 +116,47 @@ func ArcgisCacheTileHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	// 服务名
-	name, _ := vars["name"]
-	if _, ok := arcgisCaches[name]; ok {
-		arcgisCache := arcgisCaches[name]
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
 		// 级别、行、列号
 		level, _ := strconv.ParseInt(vars["level"], 10, 64)
 		row, _ := strconv.ParseInt(vars["row"], 10, 64)
 		col, _ := strconv.ParseInt(vars["col"], 10, 64)
-		bytes, _ := arcgisCache.GetTileBytes(level, row, col)
-
-		suffix := arcgisCache.GetTileFormat()
-		w.Header().Set("Content-Type", "image/"+suffix)
-		w.Write(bytes)
+		writeServiceTile(w, r, s, level, row, col)
 	} else {
 		http.NotFound(w, r)
 	}
 }
+
+// 读取并输出切片，切片缺失时按服务的缺失切片处理方式输出
+func writeServiceTile(w http.ResponseWriter, r *http.Request, s *serviceEntry, level int64, row int64, col int64) {
+	bytes, modTime, err := s.getTileBytes(level, row, col)
+	if err != nil {
+		if !isMissingTileError(err) {
+			log.Println(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// 缺失切片
+		if missingTile, contentType, ok := getMissingTile(s); ok {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(missingTile)
+		} else {
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	writeTile(w, r, s, level, row, col, bytes, modTime)
+}
+
+// 获取请求中带文件夹的服务名
+func getServiceName(r *http.Request) string {
+	vars := mux.Vars(r)
+	if folder := vars["folder"]; folder != "" {
+		return folder + "/" + vars["name"]
+	}
+	return vars["name"]
+}
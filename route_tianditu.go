@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/service"
+	"github.com/gorilla/mux"
+)
+
+// TiandituWMTSHandler 天地图兼容WMTS处理函数，地址形如/tianditu/vec_c/wmts，级别号与天地图一致。
+// 服务只有一个图层，GetTile不校验LAYER，便于直接替换天地图的各图层
+func TiandituWMTSHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+
+		query := getOGCQuery(r)
+		layer := vars["layer"]
+		if layer == "" {
+			layer = s.Config.Name
+		}
+
+		// 切片矩阵集，地址中已指定时参数须一致
+		tileMatrixSet := vars["tileMatrixSet"]
+		if tileMatrixSet != "" && query["TILEMATRIXSET"] != "" && !strings.EqualFold(query["TILEMATRIXSET"], tileMatrixSet) {
+			writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIXSET", "无效的切片矩阵集")
+			return
+		}
+
+		request := strings.ToLower(query["REQUEST"])
+		if request == "" || request == "getcapabilities" {
+			writeTiandituCapabilities(w, r, s, layer, tileMatrixSet)
+		} else if request == "gettile" {
+			if tileMatrixSet == "" {
+				tileMatrixSet = strings.ToLower(query["TILEMATRIXSET"])
+			}
+			if tileMatrixSet == "" {
+				writeOwsException(w, http.StatusBadRequest, "MissingParameterValue", "TILEMATRIXSET", "缺少参数TILEMATRIXSET")
+				return
+			}
+			for _, key := range []string{"TILEMATRIX", "TILEROW", "TILECOL"} {
+				if query[key] == "" {
+					writeOwsException(w, http.StatusBadRequest, "MissingParameterValue", key, "缺少参数"+key)
+					return
+				}
+			}
+			writeTiandituTile(w, r, s, tileMatrixSet, query["TILEMATRIX"], query["TILEROW"], query["TILECOL"])
+		} else {
+			writeOwsException(w, http.StatusBadRequest, "OperationNotSupported", "REQUEST", "不支持此操作")
+		}
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// TiandituDataServerHandler 天地图DataServer兼容切片处理函数，参数T为图层_切片矩阵集（如vec_c），x为列号、y为行号、l为级别
+func TiandituDataServerHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	t := query.Get("T")
+	tileMatrixSet := strings.ToLower(t[strings.LastIndex(t, "_")+1:])
+	level, err1 := strconv.ParseInt(query.Get("l"), 10, 64)
+	row, err2 := strconv.ParseInt(query.Get("y"), 10, 64)
+	col, err3 := strconv.ParseInt(query.Get("x"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		writeError(w, r, http.StatusBadRequest, "无效的参数", "需要参数T、x、y、l")
+		return
+	}
+
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		levels, err := arcgisCache.TiandituLevels(s.ArcgisCache.GetCacheInfo(), tileMatrixSet)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "服务不支持该切片矩阵集", err.Error())
+			return
+		}
+		cacheLevel, ok := levels[level]
+		width, height := arcgisCache.TiandituMatrixSize(tileMatrixSet, level)
+		if !ok || row < 0 || row >= height || col < 0 || col >= width {
+			http.NotFound(w, r)
+			return
+		}
+		writeServiceTile(w, r, s, cacheLevel, row, col)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// 输出天地图兼容WMTS瓦片，缓存原点与天地图一致，行列号不需转换
+func writeTiandituTile(w http.ResponseWriter, r *http.Request, s *serviceEntry, tileMatrixSet, tileMatrix, tileRow, tileCol string) {
+	levels, err := arcgisCache.TiandituLevels(s.ArcgisCache.GetCacheInfo(), tileMatrixSet)
+	if err != nil {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIXSET", "服务不支持该切片矩阵集")
+		return
+	}
+
+	// 级别
+	level, err := strconv.ParseInt(tileMatrix, 10, 64)
+	cacheLevel, ok := levels[level]
+	if err != nil || !ok {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIX", "无效的切片矩阵")
+		return
+	}
+
+	// 行、列号
+	width, height := arcgisCache.TiandituMatrixSize(tileMatrixSet, level)
+	row, err := strconv.ParseInt(tileRow, 10, 64)
+	if err != nil || row < 0 || row >= height {
+		writeOwsException(w, http.StatusBadRequest, "TileOutOfRange", "TILEROW", "行号超出范围")
+		return
+	}
+	col, err := strconv.ParseInt(tileCol, 10, 64)
+	if err != nil || col < 0 || col >= width {
+		writeOwsException(w, http.StatusBadRequest, "TileOutOfRange", "TILECOL", "列号超出范围")
+		return
+	}
+
+	writeWMTSTileBytes(w, r, s, cacheLevel, row, col)
+}
+
+// 输出天地图兼容WMTS能力文档，tileMatrixSet为空时包含服务支持的全部切片矩阵集
+func writeTiandituCapabilities(w http.ResponseWriter, r *http.Request, s *serviceEntry, layer string, tileMatrixSet string) {
+	tileMatrixSets := []string{arcgisCache.TiandituMatrixSetC, arcgisCache.TiandituMatrixSetW}
+	if tileMatrixSet != "" {
+		tileMatrixSets = []string{tileMatrixSet}
+	}
+
+	capabilities, ok := getTiandituCapabilities(r.URL.Path, getBaseURL(r), s, layer, tileMatrixSets)
+	if !ok {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIXSET", "服务不支持天地图切片矩阵集")
+		return
+	}
+	xmlBytes, err := xml.MarshalIndent(capabilities, "", "  ")
+	if err != nil {
+		log.Println(err)
+		writeOwsException(w, http.StatusInternalServerError, wmtsOwsExceptionCode, "", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(xmlBytes)
+}
+
+// 获取天地图兼容WMTS能力文档对象，服务不支持任何切片矩阵集时返回false
+func getTiandituCapabilities(path string, baseURL string, s *serviceEntry, layer string, tileMatrixSets []string) (service.WMTSCapabilities, bool) {
+	a := s.ArcgisCache
+	cacheInfo := a.GetCacheInfo()
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	serviceURL := baseURL + path
+	format := "image/" + a.GetTileFormat()
+
+	// 切片矩阵集
+	links := []service.WMTSTileMatrixSetLink{}
+	matrixSets := []service.WMTSTileMatrixSet{}
+	for _, tileMatrixSet := range tileMatrixSets {
+		levels, err := arcgisCache.TiandituLevels(cacheInfo, tileMatrixSet)
+		if err != nil || len(levels) == 0 {
+			continue
+		}
+		tiandituLevels := make([]int64, 0, len(levels))
+		for level := range levels {
+			tiandituLevels = append(tiandituLevels, level)
+		}
+		sort.Slice(tiandituLevels, func(i, j int) bool { return tiandituLevels[i] < tiandituLevels[j] })
+
+		tileMatrixes := []service.WMTSTileMatrix{}
+		for _, level := range tiandituLevels {
+			width, height := arcgisCache.TiandituMatrixSize(tileMatrixSet, level)
+			tileMatrixes = append(tileMatrixes, service.WMTSTileMatrix{
+				Identifier:       strconv.FormatInt(level, 10),
+				ScaleDenominator: arcgisCache.TiandituResolution(tileMatrixSet, level) * getMetersPerUnit(a) / wmtsPixelSize,
+				TopLeftCorner:    formatWMTSPoint(a, tileCacheInfo.TileOrigin.X, tileCacheInfo.TileOrigin.Y),
+				TileWidth:        tileCacheInfo.TileCols,
+				TileHeight:       tileCacheInfo.TileRows,
+				MatrixWidth:      width,
+				MatrixHeight:     height,
+			})
+		}
+		links = append(links, service.WMTSTileMatrixSetLink{TileMatrixSet: tileMatrixSet})
+		matrixSets = append(matrixSets, service.WMTSTileMatrixSet{
+			Title:        tileMatrixSet,
+			Identifier:   tileMatrixSet,
+			SupportedCRS: getWMTSCrs(a), // c为缓存的地理坐标系（CGCS2000或WGS84等），w为EPSG:3857
+			TileMatrixes: tileMatrixes,
+		})
+	}
+	if len(matrixSets) == 0 {
+		return service.WMTSCapabilities{}, false
+	}
+
+	// 图层，只支持KVP
+	wmtsLayer := service.WMTSLayer{
+		Title:      layer,
+		Identifier: layer,
+		Style: service.WMTSStyle{
+			IsDefault:  true,
+			Title:      "Default Style",
+			Identifier: wmtsStyle,
+		},
+		Format:            format,
+		TileMatrixSetLink: links,
+	}
+	wmtsLayer.WGS84BoundingBox = getWMTSWGS84BoundingBox(a)
+
+	operations := []service.OwsOperation{
+		{Name: "GetCapabilities", Gets: []service.OwsGet{getOwsGet(serviceURL+"?", "KVP")}},
+		{Name: "GetTile", Gets: []service.OwsGet{getOwsGet(serviceURL+"?", "KVP")}},
+	}
+	contents := service.WMTSContents{
+		Layers:         []service.WMTSLayer{wmtsLayer},
+		TileMatrixSets: matrixSets,
+	}
+	return newWMTSCapabilities(layer, operations, contents, fmt.Sprintf("%s?SERVICE=WMTS&REQUEST=GetCapabilities&VERSION=%s", serviceURL, wmtsVersion)), true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+// TileJSON版本
+const tileJSONVersion = "3.0.0"
+
+// TileJSONHandler TileJSON处理函数，f=pjson时格式化输出，支持callback
+func TileJSONHandler(w http.ResponseWriter, r *http.Request) {
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		levels, err := arcgisCache.WebMercatorLevels(s.ArcgisCache.GetCacheInfo())
+		if err != nil || len(levels) == 0 {
+			details := []string{}
+			if err != nil {
+				details = append(details, err.Error())
+			}
+			writeError(w, r, http.StatusBadRequest, "服务不支持TileJSON", details...)
+			return
+		}
+
+		tileJSON := getTileJSON(getBaseURL(r), s, levels)
+		var jsonBytes []byte
+		if getFormat(r) == "pjson" {
+			jsonBytes, err = json.MarshalIndent(tileJSON, "", "  ")
+		} else {
+			jsonBytes, err = json.Marshal(tileJSON)
+		}
+		if err != nil {
+			log.Println(err)
+			writeError(w, r, http.StatusInternalServerError, "生成TileJSON出错", err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, string(jsonBytes))
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// 获取TileJSON对象，levels为XYZ级别到缓存级别的对应关系
+func getTileJSON(baseURL string, s *serviceEntry, levels map[int64]int64) service.TileJSON {
+	metadata := arcgisCache.MergeMetadata(s.Metadata, s.ArcgisCache.GetMetadata())
+	title := metadata.DocumentInfo.Title
+	if title == "" {
+		title = s.Config.Name
+	}
+
+	// 级别范围
+	minZoom, maxZoom := int64(-1), int64(-1)
+	for z := range levels {
+		if minZoom < 0 || z < minZoom {
+			minZoom = z
+		}
+		if z > maxZoom {
+			maxZoom = z
+		}
+	}
+
+	tileJSON := service.TileJSON{
+		TileJSON:    tileJSONVersion,
+		Name:        title,
+		Description: metadata.Description,
+		Version:     "1.0.0",
+		Attribution: metadata.CopyrightText,
+		Scheme:      "xyz",
+		Tiles: []string{
+			fmt.Sprintf("%s/rest/services/%s/MapServer/xyz/{z}/{x}/{y}.%s", baseURL, s.Config.QualifiedName(), getTileExtension(s.ArcgisCache.GetTileFormat())),
+		},
+		MinZoom: minZoom,
+		MaxZoom: maxZoom,
+	}
+
+	// 范围和中心点
+	if xmin, ymin, xmax, ymax, ok := getWGS84Bounds(s.ArcgisCache); ok {
+		tileJSON.Bounds = []float64{xmin, ymin, xmax, ymax}
+		tileJSON.Center = []float64{(xmin + xmax) / 2, (ymin + ymax) / 2, float64(minZoom)}
+	}
+	return tileJSON
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/service"
+	"github.com/gorilla/mux"
+)
+
+// tilemap的最大宽高，超出时缩小范围并标记adjusted
+const maxTileMapSize = 256
+
+// TileMapHandler tilemap处理函数，返回从(row, col)开始width×height范围内切片是否存在，
+// ArcGIS JS API据此跳过不存在的切片
+func TileMapHandler(w http.ResponseWriter, r *http.Request) {
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		writeTileMap(w, r, func(level int64, row int64, col int64, width int64, height int64) ([]int, bool, error) {
+			return arcgisCache.GetTileMap(s.ArcgisCache, level, row, col, width, height)
+		})
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// 输出tilemap，getTileMap的第二个返回值为服务是否支持tilemap
+func writeTileMap(w http.ResponseWriter, r *http.Request, getTileMap func(int64, int64, int64, int64, int64) ([]int, bool, error)) {
+	vars := mux.Vars(r)
+	level, _ := strconv.ParseInt(vars["level"], 10, 64)
+	row, _ := strconv.ParseInt(vars["row"], 10, 64)
+	col, _ := strconv.ParseInt(vars["col"], 10, 64)
+	width, err1 := strconv.ParseInt(vars["width"], 10, 64)
+	height, err2 := strconv.ParseInt(vars["height"], 10, 64)
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		writeError(w, r, http.StatusBadRequest, "无效的参数", "宽高须为正整数")
+		return
+	}
+
+	tileMap := service.TileMap{
+		Location: service.TileMapLocation{Left: col, Top: row, Width: width, Height: height},
+	}
+	if width > maxTileMapSize || height > maxTileMapSize {
+		tileMap.Adjusted = true
+		if width > maxTileMapSize {
+			tileMap.Location.Width = maxTileMapSize
+		}
+		if height > maxTileMapSize {
+			tileMap.Location.Height = maxTileMapSize
+		}
+	}
+
+	data, ok, err := getTileMap(level, row, col, tileMap.Location.Width, tileMap.Location.Height)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "服务不支持tilemap")
+		return
+	}
+	if err == arcgisCache.ErrLevelOutOfRange {
+		writeError(w, r, http.StatusNotFound, "级别超出范围", fmt.Sprintf("级别%d不存在", level))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusInternalServerError, "获取tilemap出错", err.Error())
+		return
+	}
+	tileMap.Data = data
+
+	var jsonBytes []byte
+	if getFormat(r) == "pjson" {
+		jsonBytes, err = json.MarshalIndent(tileMap, "", "  ")
+	} else {
+		jsonBytes, err = json.Marshal(tileMap)
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusInternalServerError, "获取tilemap出错", err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, string(jsonBytes))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gorilla/mux"
+)
+
+// 矢量切片和字体的Content-Type
+const protobufContentType = "application/x-protobuf"
+
+// VectorTileServerHandler VectorTileServer处理函数，输出矢量切片包中root.json，f=pjson时格式化
+func VectorTileServerHandler(w http.ResponseWriter, r *http.Request) {
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquireVectorTile(name); ok {
+		defer s.release()
+
+		f := getFormat(r)
+		if f != "" && f != "html" && f != "json" && f != "pjson" {
+			writeError(w, r, http.StatusBadRequest, "不支持此格式")
+			return
+		}
+		jsonStr, err := s.VectorTile.GetVectorTileServerJSONString(s.Metadata, f != "json")
+		if err != nil {
+			log.Println(err)
+			writeError(w, r, http.StatusInternalServerError, "获取服务信息出错", err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, jsonStr)
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// VectorTileHandler 矢量切片处理函数，地址为tile/{level}/{row}/{col}.pbf，缺失的切片返回404
+func VectorTileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquireVectorTile(name); ok {
+		defer s.release()
+		level, _ := strconv.ParseInt(vars["level"], 10, 64)
+		row, _ := strconv.ParseInt(vars["row"], 10, 64)
+		col, _ := strconv.ParseInt(vars["col"], 10, 64)
+
+		data, modTime, err := s.getTileBytes(level, row, col)
+		if isMissingTileError(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		writeGzipContent(w, r, s, protobufContentType, modTime, data)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// VectorTileMapHandler 矢量切片的tilemap处理函数
+func VectorTileMapHandler(w http.ResponseWriter, r *http.Request) {
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquireVectorTile(name); ok {
+		defer s.release()
+		writeTileMap(w, r, func(level int64, row int64, col int64, width int64, height int64) ([]int, bool, error) {
+			data, err := s.VectorTile.GetTileMap(level, row, col, width, height)
+			return data, true, err
+		})
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// VectorTileResourceHandler 矢量切片包resources目录下的样式（styles/root.json）、符号（sprites/sprite.json、sprite.png）
+// 和字体（fonts/{fontstack}/{range}.pbf）处理函数
+func VectorTileResourceHandler(w http.ResponseWriter, r *http.Request) {
+	resource := mux.Vars(r)["resource"]
+
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquireVectorTile(name); ok {
+		defer s.release()
+		data, err := s.VectorTile.GetResource(resource)
+		if err == arcgisCache.ErrPackageFileNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		contentType := protobufContentType
+		if ext := strings.ToLower(path.Ext(resource)); ext != ".pbf" {
+			contentType = mime.TypeByExtension(ext)
+		}
+		writeGzipContent(w, r, s, contentType, time.Time{}, data)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// 输出可能经过gzip压缩的内容：客户端接受gzip时原样输出并设置Content-Encoding，否则解压后输出。
+// ETag按实际输出的内容计算，压缩与解压的响应ETag不同
+func writeGzipContent(w http.ResponseWriter, r *http.Request, s *serviceEntry, contentType string, modTime time.Time, data []byte) {
+	header := w.Header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if isGzip(data) {
+		header.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			header.Set("Content-Encoding", "gzip")
+		} else {
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err == nil {
+				data, err = ioutil.ReadAll(reader)
+			}
+			if err != nil {
+				log.Println(err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	setTileCacheHeaders(header, s, data)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
+
+// 是否为gzip压缩的数据
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// 请求是否接受gzip编码
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					accepted = false
+				}
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+	"github.com/gisxiaowei/basemapServer/service"
+)
+
+const (
+	wmsVersion111 = "1.1.1"
+	wmsVersion130 = "1.3.0"
+	wmsCRS84      = "CRS:84"
+)
+
+// GetMap一次最多叠加的图层数
+const maxWMSLayers = 16
+
+// WMS支持的图片格式
+var wmsFormats = map[string]string{
+	"image/png":  arcgisCache.TileFormatPNG,
+	"image/jpeg": arcgisCache.TileFormatJPEG,
+	"image/gif":  arcgisCache.TileFormatGIF,
+	"image/bmp":  arcgisCache.TileFormatBMP,
+	"image/tiff": arcgisCache.TileFormatTIFF,
+}
+
+// WMS图层，name为图层名
+type wmsLayer struct {
+	name string
+	s    *serviceEntry
+}
+
+// WMSHandler 服务的WMS处理函数，图层名为服务名（不带文件夹）
+func WMSHandler(w http.ResponseWriter, r *http.Request) {
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		title := s.Config.Name
+		serviceURL := fmt.Sprintf("%s/rest/services/%s/MapServer/WMSServer", getBaseURL(r), s.Config.QualifiedName())
+		handleWMS(w, r, title, serviceURL, []wmsLayer{{name: s.Config.Name, s: s}})
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// WMSServicesHandler 全部服务的WMS处理函数，每个服务为一个图层，图层名为带文件夹的服务名
+func WMSServicesHandler(w http.ResponseWriter, r *http.Request) {
+	entries := services.acquireAll()
+	defer func() {
+		for _, s := range entries {
+			s.release()
+		}
+	}()
+	layers := make([]wmsLayer, 0, len(entries))
+	for _, s := range entries {
+		layers = append(layers, wmsLayer{name: s.Config.QualifiedName(), s: s})
+	}
+	handleWMS(w, r, "basemapServer", getBaseURL(r)+"/wms", layers)
+}
+
+// 处理WMS请求，支持GetCapabilities和GetMap
+func handleWMS(w http.ResponseWriter, r *http.Request, title string, serviceURL string, layers []wmsLayer) {
+	query := getOGCQuery(r)
+
+	// 版本协商：低于1.3.0时使用1.1.1
+	version := query["VERSION"]
+	if version == "" {
+		version = query["WMTVER"]
+	}
+	if version != "" && version < wmsVersion130 {
+		version = wmsVersion111
+	} else {
+		version = wmsVersion130
+	}
+
+	if serviceType := query["SERVICE"]; serviceType != "" && !strings.EqualFold(serviceType, "WMS") {
+		writeWMSException(w, version, http.StatusBadRequest, "", "无效的服务类型"+serviceType)
+		return
+	}
+
+	switch strings.ToLower(query["REQUEST"]) {
+	case "", "getcapabilities", "capabilities":
+		writeWMSCapabilities(w, version, title, serviceURL, layers)
+	case "getmap", "map":
+		writeWMSMap(w, query, version, layers)
+	default:
+		writeWMSException(w, version, http.StatusBadRequest, "OperationNotSupported", "不支持此操作")
+	}
+}
+
+// 输出WMS地图
+func writeWMSMap(w http.ResponseWriter, query map[string]string, version string, layers []wmsLayer) {
+	crsKey, crsCode := "CRS", "InvalidCRS"
+	if version == wmsVersion111 {
+		crsKey, crsCode = "SRS", "InvalidSRS"
+	}
+	for _, key := range []string{"LAYERS", crsKey, "BBOX", "WIDTH", "HEIGHT", "FORMAT"} {
+		if query[key] == "" {
+			writeWMSException(w, version, http.StatusBadRequest, "MissingParameterValue", "缺少参数"+key)
+			return
+		}
+	}
+
+	// 图层
+	layerMap := make(map[string]*serviceEntry)
+	for _, layer := range layers {
+		layerMap[layer.name] = layer.s
+	}
+	requested := []*serviceEntry{}
+	requestedNames := make(map[string]bool)
+	for _, name := range strings.Split(query["LAYERS"], ",") {
+		name = strings.TrimSpace(name)
+		s, ok := layerMap[name]
+		if !ok {
+			writeWMSException(w, version, http.StatusBadRequest, "LayerNotDefined", "图层不存在："+name)
+			return
+		}
+		// 重复的图层只绘制一次
+		if requestedNames[name] {
+			continue
+		}
+		requestedNames[name] = true
+		requested = append(requested, s)
+	}
+	if len(requested) > maxWMSLayers {
+		writeWMSException(w, version, http.StatusBadRequest, "", fmt.Sprintf("LAYERS最多包含%d个图层", maxWMSLayers))
+		return
+	}
+	for _, style := range strings.Split(query["STYLES"], ",") {
+		if style = strings.TrimSpace(style); style != "" && !strings.EqualFold(style, "default") {
+			writeWMSException(w, version, http.StatusBadRequest, "StyleNotDefined", "样式不存在："+style)
+			return
+		}
+	}
+
+	// 格式
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(query["FORMAT"], ";")[0]))
+	format, ok := wmsFormats[mimeType]
+	if !ok {
+		writeWMSException(w, version, http.StatusBadRequest, "InvalidFormat", "不支持的格式："+query["FORMAT"])
+		return
+	}
+
+	// 大小
+	width, err1 := strconv.Atoi(query["WIDTH"])
+	height, err2 := strconv.Atoi(query["HEIGHT"])
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 || width > maxExportSize || height > maxExportSize {
+		writeWMSException(w, version, http.StatusBadRequest, "", fmt.Sprintf("WIDTH、HEIGHT须在1~%d之间", maxExportSize))
+		return
+	}
+
+	// 坐标系和范围，1.3.0中EPSG地理坐标系的轴顺序为纬度、经度
+	sr, swapAxis, ok := parseWMSCRS(query[crsKey], version)
+	if !ok {
+		writeWMSException(w, version, http.StatusBadRequest, crsCode, "不支持的坐标系："+query[crsKey])
+		return
+	}
+	bbox, ok := parseBBox(query["BBOX"])
+	if !ok {
+		writeWMSException(w, version, http.StatusBadRequest, "", "BBOX格式为minx,miny,maxx,maxy")
+		return
+	}
+	if swapAxis {
+		bbox = [4]float64{bbox[1], bbox[0], bbox[3], bbox[2]}
+	}
+	for _, s := range requested {
+		if _, err := arcgisCache.GetTransform(sr, s.ArcgisCache.GetCacheInfo().TileCacheInfo.SpatialReference); err != nil {
+			writeWMSException(w, version, http.StatusBadRequest, crsCode, fmt.Sprintf("图层%s不支持坐标系%s", s.Config.Name, query[crsKey]))
+			return
+		}
+	}
+
+	// 按顺序叠加图层，第一个图层在最下面
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for _, s := range requested {
+		img, err := renderMap(s, bbox, width, height, sr)
+		if err == arcgisCache.ErrLevelOutOfRange || err == arcgisCache.ErrTooManyTiles {
+			// 与图层的比例尺范围一样，缓存没有与输出分辨率相近的级别时不绘制该图层
+			continue
+		}
+		if err != nil {
+			log.Println(err)
+			writeWMSException(w, version, http.StatusInternalServerError, "", "生成地图出错")
+			return
+		}
+		draw.Draw(dst, dst.Bounds(), img, image.Point{}, draw.Over)
+	}
+
+	// 背景
+	if !strings.EqualFold(query["TRANSPARENT"], "TRUE") {
+		background, ok := parseWMSColor(query["BGCOLOR"])
+		if !ok {
+			writeWMSException(w, version, http.StatusBadRequest, "", "BGCOLOR格式为0xRRGGBB")
+			return
+		}
+		dst = withBackground(dst, background)
+	}
+	writeMapImage(w, dst, format)
+}
+
+// 解析WMS坐标系，返回空间参考和范围是否为纬度、经度顺序
+func parseWMSCRS(value string, version string) (conf.SpatialReference, bool, bool) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == wmsCRS84 {
+		return conf.SpatialReference{WKID: 4326}, false, true
+	}
+	if !strings.HasPrefix(value, "EPSG:") {
+		return conf.SpatialReference{}, false, false
+	}
+	sr, err := arcgisCache.ParseSpatialReference(value)
+	if err != nil {
+		return conf.SpatialReference{}, false, false
+	}
+	return sr, version == wmsVersion130 && arcgisCache.IsGeographic(sr), true
+}
+
+// 解析背景颜色0xRRGGBB，为空时为白色
+func parseWMSColor(value string) (color.Color, bool) {
+	if value == "" {
+		return color.White, true
+	}
+	value = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(value), "0x"), "#")
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil || len(value) != 6 {
+		return nil, false
+	}
+	return color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, true
+}
+
+// 输出WMS能力文档
+func writeWMSCapabilities(w http.ResponseWriter, version string, title string, serviceURL string, layers []wmsLayer) {
+	capabilities := getWMSCapabilities(version, title, serviceURL, layers)
+	xmlBytes, err := xml.MarshalIndent(capabilities, "", "  ")
+	if err != nil {
+		log.Println(err)
+		writeWMSException(w, version, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	if version == wmsVersion111 {
+		w.Header().Set("Content-Type", "application/vnd.ogc.wms_xml")
+	} else {
+		w.Header().Set("Content-Type", "text/xml")
+	}
+	w.Write([]byte(xml.Header))
+	w.Write(xmlBytes)
+}
+
+// 获取WMS能力文档对象
+func getWMSCapabilities(version string, title string, serviceURL string, layers []wmsLayer) service.WMSCapabilities {
+	onlineResource := service.WMSOnlineResource{Type: "simple", Href: serviceURL + "?"}
+	formats := []string{"image/png", "image/jpeg", "image/gif", "image/bmp", "image/tiff"}
+
+	capabilities := service.WMSCapabilities{
+		Version:    version,
+		XmlnsXlink: "http://www.w3.org/1999/xlink",
+		Service: service.WMSService{
+			Name:           "WMS",
+			Title:          title,
+			OnlineResource: onlineResource,
+		},
+		Capability: service.WMSCapability{
+			Request: service.WMSRequest{
+				GetMap: service.WMSOperation{Formats: formats, OnlineResource: onlineResource},
+			},
+		},
+	}
+	if version == wmsVersion111 {
+		capabilities.XMLName = xml.Name{Local: "WMT_MS_Capabilities"}
+		capabilities.Service.Name = "OGC:WMS"
+		capabilities.Capability.Request.GetCapabilities = service.WMSOperation{Formats: []string{"application/vnd.ogc.wms_xml"}, OnlineResource: onlineResource}
+		capabilities.Capability.Exception = []string{"application/vnd.ogc.se_xml"}
+	} else {
+		capabilities.XMLName = xml.Name{Local: "WMS_Capabilities"}
+		capabilities.Xmlns = "http://www.opengis.net/wms"
+		capabilities.XmlnsXsi = "http://www.w3.org/2001/XMLSchema-instance"
+		capabilities.SchemaLocation = "http://www.opengis.net/wms http://schemas.opengis.net/wms/1.3.0/capabilities_1_3_0.xsd"
+		capabilities.Service.MaxWidth = maxExportSize
+		capabilities.Service.MaxHeight = maxExportSize
+		capabilities.Capability.Request.GetCapabilities = service.WMSOperation{Formats: []string{"text/xml"}, OnlineResource: onlineResource}
+		capabilities.Capability.Exception = []string{"XML"}
+	}
+
+	// 根图层没有名称，子图层为各服务，坐标系由各子图层声明
+	root := service.WMSLayer{Title: title, Layers: []service.WMSLayer{}}
+	for _, layer := range layers {
+		root.Layers = append(root.Layers, getWMSLayer(version, layer))
+	}
+	capabilities.Capability.Layer = root
+	return capabilities
+}
+
+// 获取服务对应的WMS图层
+func getWMSLayer(version string, layer wmsLayer) service.WMSLayer {
+	a := layer.s.ArcgisCache
+	metadata := arcgisCache.MergeMetadata(layer.s.Metadata, a.GetMetadata())
+	title := metadata.DocumentInfo.Title
+	if title == "" {
+		title = layer.name
+	}
+	wmsLayer := service.WMSLayer{
+		Opaque:   1,
+		Name:     layer.name,
+		Title:    title,
+		Abstract: metadata.Description,
+	}
+
+	// 支持的坐标系及其范围
+	cacheSR := a.GetCacheInfo().TileCacheInfo.SpatialReference
+	envelope := a.GetEnvelope()
+	bbox := [4]float64{envelope.XMin, envelope.YMin, envelope.XMax, envelope.YMax}
+	for _, code := range getWMSLayerCRS(cacheSR) {
+		sr, swapAxis, _ := parseWMSCRS(code, version)
+		transform, err := arcgisCache.GetTransform(cacheSR, sr)
+		if err != nil {
+			continue
+		}
+		b := transformBBox(bbox, transform)
+		if swapAxis {
+			b = [4]float64{b[1], b[0], b[3], b[2]}
+		}
+		boundingBox := service.WMSBoundingBox{MinX: b[0], MinY: b[1], MaxX: b[2], MaxY: b[3]}
+		if version == wmsVersion111 {
+			wmsLayer.SRS = append(wmsLayer.SRS, code)
+			boundingBox.SRS = code
+		} else {
+			wmsLayer.CRS = append(wmsLayer.CRS, code)
+			boundingBox.CRS = code
+		}
+		wmsLayer.BoundingBoxes = append(wmsLayer.BoundingBoxes, boundingBox)
+	}
+
+	// 经纬度范围
+	if xmin, ymin, xmax, ymax, ok := getWGS84Bounds(a); ok {
+		if version == wmsVersion111 {
+			wmsLayer.LatLonBoundingBox = &service.WMSBoundingBox{MinX: xmin, MinY: ymin, MaxX: xmax, MaxY: ymax}
+		} else {
+			wmsLayer.CRS = append(wmsLayer.CRS, wmsCRS84)
+			wmsLayer.EXGeographicBoundingBox = &service.WMSGeographicBoundingBox{
+				WestBoundLongitude: xmin,
+				EastBoundLongitude: xmax,
+				SouthBoundLatitude: ymin,
+				NorthBoundLatitude: ymax,
+			}
+		}
+	}
+	return wmsLayer
+}
+
+// 获取图层支持的EPSG坐标系：缓存的坐标系，地理坐标系和Web墨卡托的缓存另支持EPSG:4326和EPSG:3857
+func getWMSLayerCRS(cacheSR conf.SpatialReference) []string {
+	codes := []string{}
+	seen := make(map[string]bool)
+	add := func(wkid int64) {
+		code := fmt.Sprintf("EPSG:%d", wkid)
+		if wkid > 0 && wkid < 100000 && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	wkid := cacheSR.LatestWKID
+	if wkid == 0 {
+		wkid = cacheSR.WKID
+	}
+	add(wkid)
+	if arcgisCache.IsGeographic(cacheSR) || arcgisCache.IsWebMercator(cacheSR.WKID) || arcgisCache.IsWebMercator(cacheSR.LatestWKID) {
+		add(4326)
+		add(3857)
+	}
+	return codes
+}
+
+// 输出OGC服务异常报告
+func writeWMSException(w http.ResponseWriter, version string, code int, exceptionCode string, message string) {
+	report := service.WMSServiceExceptionReport{
+		Version:    version,
+		Exceptions: []service.WMSServiceException{{Code: exceptionCode, Message: message}},
+	}
+	contentType := "application/vnd.ogc.se_xml"
+	if version == wmsVersion130 {
+		report.Xmlns = "http://www.opengis.net/ogc"
+		contentType = "text/xml"
+	}
+	xmlBytes, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, message, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	w.Write(xmlBytes)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gisxiaowei/basemapServer/config"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+	"github.com/gisxiaowei/basemapServer/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	wmtsVersion          = "1.0.0"
+	wmtsStyle            = "default"
+	wmtsTileMatrixSet    = "default"
+	wmtsPixelSize        = 0.00028 // OGC标准像素大小（米）
+	wmtsOwsExceptionCode = "NoApplicableCode"
+	maxEPSGCode          = 32767 // EPSG坐标系编号的上限，更大的编号为ESRI编号
+)
+
+// WMTSHandler WMTS KVP处理函数
+func WMTSHandler(w http.ResponseWriter, r *http.Request) {
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+
+		// request
+		query := getOGCQuery(r)
+		request := strings.ToLower(query["REQUEST"])
+		if request == "" || request == "getcapabilities" {
+			writeWMTSCapabilities(w, r, s)
+		} else if request == "gettile" {
+			for _, key := range []string{"LAYER", "TILEMATRIXSET", "TILEMATRIX", "TILEROW", "TILECOL"} {
+				if query[key] == "" {
+					writeOwsException(w, http.StatusBadRequest, "MissingParameterValue", key, "缺少参数"+key)
+					return
+				}
+			}
+			writeWMTSTile(w, r, s, query["LAYER"], query["TILEMATRIXSET"], query["TILEMATRIX"], query["TILEROW"], query["TILECOL"])
+		} else {
+			writeOwsException(w, http.StatusBadRequest, "OperationNotSupported", "REQUEST", "不支持此操作")
+		}
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// WMTSCapabilitiesHandler WMTS RESTful能力文档处理函数
+func WMTSCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		writeWMTSCapabilities(w, r, s)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// WMTSTileHandler WMTS RESTful瓦片处理函数
+func WMTSTileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// 服务名
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		writeWMTSTile(w, r, s, vars["layer"], vars["tileMatrixSet"], vars["tileMatrix"], vars["row"], vars["col"])
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// 输出WMTS能力文档
+func writeWMTSCapabilities(w http.ResponseWriter, r *http.Request, s *serviceEntry) {
+	capabilities := getWMTSCapabilities(getBaseURL(r), s.Config, s.ArcgisCache)
+	xmlBytes, err := xml.MarshalIndent(capabilities, "", "  ")
+	if err != nil {
+		log.Println(err)
+		writeOwsException(w, http.StatusInternalServerError, wmtsOwsExceptionCode, "", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(xmlBytes)
+}
+
+// 输出WMTS瓦片
+func writeWMTSTile(w http.ResponseWriter, r *http.Request, s *serviceEntry, layer, tileMatrixSet, tileMatrix, tileRow, tileCol string) {
+	arcgisCache := s.ArcgisCache
+	if layer != s.Config.Name {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "LAYER", "无效的图层")
+		return
+	}
+	if tileMatrixSet != wmtsTileMatrixSet {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIXSET", "无效的切片矩阵集")
+		return
+	}
+
+	// 级别
+	level, err := strconv.ParseInt(tileMatrix, 10, 64)
+	matrix, ok := getWMTSTileMatrix(arcgisCache, level)
+	if err != nil || !ok {
+		writeOwsException(w, http.StatusBadRequest, "InvalidParameterValue", "TILEMATRIX", "无效的切片矩阵")
+		return
+	}
+
+	// 行、列号
+	row, err := strconv.ParseInt(tileRow, 10, 64)
+	if err != nil || row < 0 || row >= matrix.MatrixHeight {
+		writeOwsException(w, http.StatusBadRequest, "TileOutOfRange", "TILEROW", "行号超出范围")
+		return
+	}
+	col, err := strconv.ParseInt(tileCol, 10, 64)
+	if err != nil || col < 0 || col >= matrix.MatrixWidth {
+		writeOwsException(w, http.StatusBadRequest, "TileOutOfRange", "TILECOL", "列号超出范围")
+		return
+	}
+
+	writeWMTSTileBytes(w, r, s, level, row, col)
+}
+
+// 读取并输出WMTS瓦片，缺失时按服务配置输出占位图片或OWS异常
+func writeWMTSTileBytes(w http.ResponseWriter, r *http.Request, s *serviceEntry, level int64, row int64, col int64) {
+	bytes, modTime, err := s.getTileBytes(level, row, col)
+	if err != nil {
+		if !isMissingTileError(err) {
+			log.Println(err)
+			writeOwsException(w, http.StatusInternalServerError, wmtsOwsExceptionCode, "", "读取切片出错")
+			return
+		}
+
+		// 缺失切片
+		if missingTile, contentType, ok := getMissingTile(s); ok {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(missingTile)
+		} else {
+			writeOwsException(w, http.StatusNotFound, wmtsOwsExceptionCode, "", "切片不存在")
+		}
+		return
+	}
+
+	writeTile(w, r, s, level, row, col, bytes, modTime)
+}
+
+// 输出OWS异常报告
+func writeOwsException(w http.ResponseWriter, code int, exceptionCode string, locator string, message string) {
+	report := service.OwsExceptionReport{
+		XmlnsOws: "http://www.opengis.net/ows/1.1",
+		Version:  "1.1.0",
+		Lang:     "zh-CN",
+		Exception: service.OwsException{
+			ExceptionCode: exceptionCode,
+			Locator:       locator,
+			ExceptionText: message,
+		},
+	}
+	xmlBytes, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, message, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	w.Write(xmlBytes)
+}
+
+// 获取OGC请求参数，参数名不区分大小写，统一转为大写
+func getOGCQuery(r *http.Request) map[string]string {
+	query := map[string]string{}
+	for key, values := range r.URL.Query() {
+		if len(values) > 0 {
+			query[strings.ToUpper(key)] = strings.TrimSpace(values[0])
+		}
+	}
+	return query
+}
+
+// 获取WMTS能力文档对象
+func getWMTSCapabilities(baseURL string, c config.Service, arcgisCache arcgisCache.ArcgisCache) service.WMTSCapabilities {
+	// 图层标识为不带文件夹的服务名
+	name := c.Name
+	serviceURL := fmt.Sprintf("%s/rest/services/%s/MapServer/WMTS", baseURL, c.QualifiedName())
+	cacheInfo := arcgisCache.GetCacheInfo()
+	format := "image/" + arcgisCache.GetTileFormat()
+
+	// 切片矩阵
+	tileMatrixes := []service.WMTSTileMatrix{}
+	for _, lodInfo := range cacheInfo.TileCacheInfo.LODInfos {
+		matrix, _ := getWMTSTileMatrix(arcgisCache, lodInfo.LevelID)
+		tileMatrixes = append(tileMatrixes, matrix)
+	}
+
+	// 图层
+	layer := service.WMTSLayer{
+		Title:       name,
+		Identifier:  name,
+		BoundingBox: getWMTSBoundingBox(arcgisCache),
+		Style: service.WMTSStyle{
+			IsDefault:  true,
+			Title:      "Default Style",
+			Identifier: wmtsStyle,
+		},
+		Format: format,
+		TileMatrixSetLink: []service.WMTSTileMatrixSetLink{
+			{TileMatrixSet: wmtsTileMatrixSet},
+		},
+		ResourceURL: &service.WMTSResourceURL{
+			Format:       format,
+			ResourceType: "tile",
+			Template:     fmt.Sprintf("%s/tile/%s/%s/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}", serviceURL, wmtsVersion, name),
+		},
+	}
+	layer.WGS84BoundingBox = getWMTSWGS84BoundingBox(arcgisCache)
+
+	operations := []service.OwsOperation{
+		{
+			Name: "GetCapabilities",
+			Gets: []service.OwsGet{
+				getOwsGet(fmt.Sprintf("%s/%s/WMTSCapabilities.xml", serviceURL, wmtsVersion), "RESTful"),
+				getOwsGet(serviceURL+"?", "KVP"),
+			},
+		},
+		{
+			Name: "GetTile",
+			Gets: []service.OwsGet{
+				getOwsGet(fmt.Sprintf("%s/tile/%s/", serviceURL, wmtsVersion), "RESTful"),
+				getOwsGet(serviceURL+"?", "KVP"),
+			},
+		},
+	}
+	contents := service.WMTSContents{
+		Layers: []service.WMTSLayer{layer},
+		TileMatrixSets: []service.WMTSTileMatrixSet{
+			{
+				Title:        wmtsTileMatrixSet,
+				Identifier:   wmtsTileMatrixSet,
+				SupportedCRS: getWMTSCrs(arcgisCache),
+				TileMatrixes: tileMatrixes,
+			},
+		},
+	}
+	return newWMTSCapabilities(name, operations, contents, fmt.Sprintf("%s/%s/WMTSCapabilities.xml", serviceURL, wmtsVersion))
+}
+
+// 创建WMTS能力文档对象
+func newWMTSCapabilities(title string, operations []service.OwsOperation, contents service.WMTSContents, metadataURL string) service.WMTSCapabilities {
+	return service.WMTSCapabilities{
+		Xmlns:          "http://www.opengis.net/wmts/1.0",
+		XmlnsOws:       "http://www.opengis.net/ows/1.1",
+		XmlnsXlink:     "http://www.w3.org/1999/xlink",
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsGml:       "http://www.opengis.net/gml",
+		SchemaLocation: "http://www.opengis.net/wmts/1.0 http://schemas.opengis.net/wmts/1.0/wmtsGetCapabilities_response.xsd",
+		Version:        wmtsVersion,
+		ServiceIdentification: service.OwsServiceIdentification{
+			Title:              title,
+			ServiceType:        "OGC WMTS",
+			ServiceTypeVersion: wmtsVersion,
+		},
+		OperationsMetadata: service.OwsOperationsMetadata{
+			Operations: operations,
+		},
+		Contents: contents,
+		ServiceMetadataURL: service.XlinkHref{
+			Href: metadataURL,
+		},
+	}
+}
+
+// 获取操作的请求地址，encoding为KVP或RESTful
+func getOwsGet(href string, encoding string) service.OwsGet {
+	return service.OwsGet{
+		Href:       href,
+		Constraint: service.OwsConstraint{Name: "GetEncoding", AllowedValues: []string{encoding}},
+	}
+}
+
+// 获取指定级别的切片矩阵
+func getWMTSTileMatrix(a arcgisCache.ArcgisCache, level int64) (service.WMTSTileMatrix, bool) {
+	cacheInfo := a.GetCacheInfo()
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	envelope := a.GetEnvelope()
+	for _, lodInfo := range tileCacheInfo.LODInfos {
+		if lodInfo.LevelID != level {
+			continue
+		}
+
+		// 矩阵行列数：从原点覆盖到范围的右下角。范围为空或不在切片坐标系下时，
+		// 使用与原点关于坐标原点对称的完整范围（Web墨卡托、经纬度切片方案即为全球）
+		originX := tileCacheInfo.TileOrigin.X
+		originY := tileCacheInfo.TileOrigin.Y
+		xmax, ymin := -originX, -originY
+		if envelope.XMax > envelope.XMin && envelope.YMax > envelope.YMin &&
+			arcgisCache.IsSameSpatialReference(envelope.SpatialReference, tileCacheInfo.SpatialReference) {
+			xmax, ymin = envelope.XMax, envelope.YMin
+		}
+		tileWidth := lodInfo.Resolution * float64(tileCacheInfo.TileCols)
+		tileHeight := lodInfo.Resolution * float64(tileCacheInfo.TileRows)
+		matrixWidth := int64(math.Max(1, math.Ceil((xmax-originX)/tileWidth)))
+		matrixHeight := int64(math.Max(1, math.Ceil((originY-ymin)/tileHeight)))
+
+		return service.WMTSTileMatrix{
+			Identifier:       strconv.FormatInt(lodInfo.LevelID, 10),
+			ScaleDenominator: lodInfo.Resolution * getMetersPerUnit(a) / wmtsPixelSize,
+			TopLeftCorner:    formatWMTSPoint(a, originX, originY),
+			TileWidth:        tileCacheInfo.TileCols,
+			TileHeight:       tileCacheInfo.TileRows,
+			MatrixWidth:      matrixWidth,
+			MatrixHeight:     matrixHeight,
+		}, true
+	}
+	return service.WMTSTileMatrix{}, false
+}
+
+// 获取图层范围
+func getWMTSBoundingBox(arcgisCache arcgisCache.ArcgisCache) *service.OwsBoundingBox {
+	envelope := arcgisCache.GetEnvelope()
+	return &service.OwsBoundingBox{
+		Crs:         getWMTSCrs(arcgisCache),
+		LowerCorner: formatWMTSPoint(arcgisCache, envelope.XMin, envelope.YMin),
+		UpperCorner: formatWMTSPoint(arcgisCache, envelope.XMax, envelope.YMax),
+	}
+}
+
+// 获取图层WGS84范围，无法转换的坐标系返回nil
+func getWMTSWGS84BoundingBox(a arcgisCache.ArcgisCache) *service.OwsBoundingBox {
+	xmin, ymin, xmax, ymax, ok := getWGS84Bounds(a)
+	if !ok {
+		return nil
+	}
+	return &service.OwsBoundingBox{
+		LowerCorner: fmt.Sprintf("%v %v", xmin, ymin),
+		UpperCorner: fmt.Sprintf("%v %v", xmax, ymax),
+	}
+}
+
+// 获取范围的经纬度，无法转换的坐标系返回false
+func getWGS84Bounds(a arcgisCache.ArcgisCache) (xmin, ymin, xmax, ymax float64, ok bool) {
+	envelope := a.GetEnvelope()
+	spatialReference := a.GetCacheInfo().TileCacheInfo.SpatialReference
+	xmin, ymin, xmax, ymax = envelope.XMin, envelope.YMin, envelope.XMax, envelope.YMax
+	if arcgisCache.IsWebMercator(spatialReference.WKID) || arcgisCache.IsWebMercator(spatialReference.LatestWKID) {
+		xmin, ymin = arcgisCache.WebMercatorToLonLat(xmin, ymin)
+		xmax, ymax = arcgisCache.WebMercatorToLonLat(xmax, ymax)
+	} else if !isGeographic(a) {
+		return 0, 0, 0, 0, false
+	}
+	xmin, xmax = math.Max(xmin, -180), math.Min(xmax, 180)
+	ymin, ymax = math.Max(ymin, -90), math.Min(ymax, 90)
+	return xmin, ymin, xmax, ymax, true
+}
+
+// 获取坐标系标识
+func getWMTSCrs(a arcgisCache.ArcgisCache) string {
+	return getCrsURN(a.GetCacheInfo().TileCacheInfo.SpatialReference)
+}
+
+// 获取空间参考的URN。Web墨卡托的ESRI编号（102100、102113）和900913使用EPSG:3857，
+// 其他32767以上的编号（如102xxx、104xxx）没有对应的EPSG编号，使用ESRI命名空间
+func getCrsURN(sr conf.SpatialReference) string {
+	wkid := sr.LatestWKID
+	if wkid == 0 {
+		wkid = sr.WKID
+	}
+	if arcgisCache.IsWebMercator(wkid) {
+		wkid = 3857
+	}
+	if wkid > maxEPSGCode {
+		return fmt.Sprintf("urn:ogc:def:crs:ESRI::%d", wkid)
+	}
+	return fmt.Sprintf("urn:ogc:def:crs:EPSG::%d", wkid)
+}
+
+// 格式化坐标，EPSG地理坐标系的轴顺序为纬度、经度
+func formatWMTSPoint(arcgisCache arcgisCache.ArcgisCache, x float64, y float64) string {
+	if isGeographic(arcgisCache) {
+		return fmt.Sprintf("%v %v", y, x)
+	}
+	return fmt.Sprintf("%v %v", x, y)
+}
+
+// 获取每个坐标单位对应的米数
+func getMetersPerUnit(a arcgisCache.ArcgisCache) float64 {
+	return arcgisCache.MetersPerUnit(a.GetCacheInfo().TileCacheInfo.SpatialReference)
+}
+
+// 是否为地理坐标系
+func isGeographic(a arcgisCache.ArcgisCache) bool {
+	return arcgisCache.IsGeographic(a.GetCacheInfo().TileCacheInfo.SpatialReference)
+}
+
+// 获取请求的根地址
+func getBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
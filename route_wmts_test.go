@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache/conf"
+)
+
+func TestGetCrsURN(t *testing.T) {
+	tests := []struct {
+		sr   conf.SpatialReference
+		want string
+	}{
+		{conf.SpatialReference{WKID: 102100, LatestWKID: 3857}, "urn:ogc:def:crs:EPSG::3857"},
+		{conf.SpatialReference{WKID: 102100}, "urn:ogc:def:crs:EPSG::3857"},
+		{conf.SpatialReference{WKID: 102113}, "urn:ogc:def:crs:EPSG::3857"},
+		{conf.SpatialReference{WKID: 900913}, "urn:ogc:def:crs:EPSG::3857"},
+		{conf.SpatialReference{WKID: 4490, LatestWKID: 4490}, "urn:ogc:def:crs:EPSG::4490"},
+		{conf.SpatialReference{WKID: 4326}, "urn:ogc:def:crs:EPSG::4326"},
+		{conf.SpatialReference{WKID: 102024}, "urn:ogc:def:crs:ESRI::102024"},
+		{conf.SpatialReference{WKID: 104020}, "urn:ogc:def:crs:ESRI::104020"},
+	}
+	for _, tt := range tests {
+		if got := getCrsURN(tt.sr); got != tt.want {
+			t.Errorf("getCrsURN(%d, %d) = %q，期望%q", tt.sr.WKID, tt.sr.LatestWKID, got, tt.want)
+		}
+	}
+}
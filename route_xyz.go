@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+	"github.com/gisxiaowei/basemapServer/service"
+	"github.com/gorilla/mux"
+)
+
+// XYZTileHandler XYZ瓦片处理函数，y轴向下，与Google、OSM一致
+func XYZTileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	z, _ := strconv.ParseInt(vars["z"], 10, 64)
+	x, _ := strconv.ParseInt(vars["x"], 10, 64)
+	y, _ := strconv.ParseInt(vars["y"], 10, 64)
+	writeXYZTile(w, r, z, x, y)
+}
+
+// TMSTileHandler TMS瓦片处理函数，y轴向上
+func TMSTileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	z, _ := strconv.ParseInt(vars["z"], 10, 64)
+	x, _ := strconv.ParseInt(vars["x"], 10, 64)
+	y, _ := strconv.ParseInt(vars["y"], 10, 64)
+	if z < 0 || z > 30 {
+		http.NotFound(w, r)
+		return
+	}
+	writeXYZTile(w, r, z, x, (int64(1)<<uint(z))-1-y)
+}
+
+// QuadkeyTileHandler Bing quadkey瓦片处理函数
+func QuadkeyTileHandler(w http.ResponseWriter, r *http.Request) {
+	quadkey := mux.Vars(r)["quadkey"]
+	z := int64(len(quadkey))
+	var x, y int64
+	for i := int64(0); i < z; i++ {
+		mask := int64(1) << uint(z-1-i)
+		digit := quadkey[i] - '0'
+		if digit&1 != 0 {
+			x |= mask
+		}
+		if digit&2 != 0 {
+			y |= mask
+		}
+	}
+	writeXYZTile(w, r, z, x, y)
+}
+
+// BaiduTileHandler 百度切片处理函数，切片号以百度墨卡托原点为(0,0)、y轴向上，仅支持百度切片方案的服务
+func BaiduTileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	z, _ := strconv.ParseInt(vars["z"], 10, 64)
+	x, _ := strconv.ParseInt(vars["x"], 10, 64)
+	y, _ := strconv.ParseInt(vars["y"], 10, 64)
+
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		if !arcgisCache.IsBaiduMercator(s.ArcgisCache.GetCacheInfo().TileCacheInfo.SpatialReference) {
+			writeError(w, r, http.StatusBadRequest, "服务不支持百度切片", "服务需配置datumShift转换为bd09")
+			return
+		}
+		if z < 1 || z > 30 {
+			http.NotFound(w, r)
+			return
+		}
+		level, row, col := arcgisCache.BaiduTileToLevelRowCol(z, x, y)
+		writeServiceTile(w, r, s, level, row, col)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// TMSTileMapResourceHandler TMS切片地图资源处理函数
+func TMSTileMapResourceHandler(w http.ResponseWriter, r *http.Request) {
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		levels, err := arcgisCache.WebMercatorLevels(s.ArcgisCache.GetCacheInfo())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "服务不支持TMS", err.Error())
+			return
+		}
+
+		tileMap := getTMSTileMap(getBaseURL(r), s, levels)
+		xmlBytes, err := xml.MarshalIndent(tileMap, "", "  ")
+		if err != nil {
+			log.Println(err)
+			writeError(w, r, http.StatusInternalServerError, "生成TMS资源出错", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(xml.Header))
+		w.Write(xmlBytes)
+	} else {
+		writeError(w, r, http.StatusNotFound, "服务不存在", fmt.Sprintf("服务%s不存在", name))
+	}
+}
+
+// 将XYZ行列号转为缓存的级别、行、列号并输出切片
+func writeXYZTile(w http.ResponseWriter, r *http.Request, z int64, x int64, y int64) {
+	name := getServiceName(r)
+	if s, ok := services.acquire(name); ok {
+		defer s.release()
+		levels, err := arcgisCache.WebMercatorLevels(s.ArcgisCache.GetCacheInfo())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "服务不支持XYZ切片", err.Error())
+			return
+		}
+
+		level, ok := levels[z]
+		if !ok || z > 30 || x < 0 || y < 0 || x >= int64(1)<<uint(z) || y >= int64(1)<<uint(z) {
+			http.NotFound(w, r)
+			return
+		}
+		writeServiceTile(w, r, s, level, y, x)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// 获取TMS切片地图资源对象
+func getTMSTileMap(baseURL string, s *serviceEntry, levels map[int64]int64) service.TMSTileMap {
+	serviceURL := fmt.Sprintf("%s/rest/services/%s/MapServer/tms", baseURL, s.Config.QualifiedName())
+	cacheInfo := s.ArcgisCache.GetCacheInfo()
+	tileCacheInfo := cacheInfo.TileCacheInfo
+	envelope := s.ArcgisCache.GetEnvelope()
+
+	// 级别对应的分辨率
+	resolutions := make(map[int64]float64)
+	for _, lodInfo := range tileCacheInfo.LODInfos {
+		resolutions[lodInfo.LevelID] = lodInfo.Resolution
+	}
+	zooms := make([]int64, 0, len(levels))
+	for z := range levels {
+		zooms = append(zooms, z)
+	}
+	sort.Slice(zooms, func(i, j int) bool { return zooms[i] < zooms[j] })
+	tileSets := []service.TMSTileSet{}
+	for _, z := range zooms {
+		tileSets = append(tileSets, service.TMSTileSet{
+			Href:          fmt.Sprintf("%s/%d", serviceURL, z),
+			UnitsPerPixel: resolutions[levels[z]],
+			Order:         z,
+		})
+	}
+
+	format := s.ArcgisCache.GetTileFormat()
+	return service.TMSTileMap{
+		Version:        "1.0.0",
+		TileMapService: serviceURL,
+		Title:          s.Config.Name,
+		Abstract:       s.Metadata.Description,
+		SRS:            "EPSG:3857",
+		BoundingBox: service.TMSBoundingBox{
+			MinX: envelope.XMin,
+			MinY: envelope.YMin,
+			MaxX: envelope.XMax,
+			MaxY: envelope.YMax,
+		},
+		// TMS原点在左下角
+		Origin: service.TMSOrigin{
+			X: tileCacheInfo.TileOrigin.X,
+			Y: -tileCacheInfo.TileOrigin.Y,
+		},
+		TileFormat: service.TMSTileFormat{
+			Width:     tileCacheInfo.TileCols,
+			Height:    tileCacheInfo.TileRows,
+			MimeType:  "image/" + format,
+			Extension: getTileExtension(format),
+		},
+		TileSets: service.TMSTileSets{
+			Profile:  "global-mercator",
+			TileSets: tileSets,
+		},
+	}
+}
+
+// 获取切片格式对应的文件扩展名
+func getTileExtension(format string) string {
+	switch arcgisCache.NormalizeTileFormat(format) {
+	case arcgisCache.TileFormatJPEG:
+		return "jpg"
+	case arcgisCache.TileFormatWebP:
+		return "webp"
+	}
+	return "png"
+}
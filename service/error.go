@@ -1,6 +1,12 @@
 package service
 
 type Error struct {
-	Message string
-	Code    int
+	Message string   `json:"message"`
+	Code    int      `json:"code"`
+	Details []string `json:"details"`
+}
+
+// ErrorResponse ArcGIS REST格式的错误
+type ErrorResponse struct {
+	Error Error `json:"error"`
 }
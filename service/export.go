@@ -0,0 +1,9 @@
+package service
+
+type ExportImage struct {
+	Href   string  `json:"href"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Extent Extent  `json:"extent"`
+	Scale  float64 `json:"scale"`
+}
@@ -14,8 +14,8 @@ type MapServer struct {
 	TileInfo                  TileInfo         `json:"tileInfo"`
 	InitialExtent             Extent           `json:"initialExtent"`
 	FullExtent                Extent           `json:"fullExtent"`
-	MinScale                  int64            `json:"minScale"`
-	MaxScale                  int64            `json:"maxScale"`
+	MinScale                  float64          `json:"minScale"`
+	MaxScale                  float64          `json:"maxScale"`
 	Units                     string           `json:"units"`
 	SupportedImageFormatTypes string           `json:"supportedImageFormatTypes"`
 	DocumentInfo              DocumentInfo     `json:"documentInfo"`
@@ -38,8 +38,8 @@ type TileInfo struct {
 }
 
 type Point struct {
-	X int64 `json:"x"`
-	Y int64 `json:"y"`
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 type Extent struct {
@@ -51,14 +51,15 @@ type Extent struct {
 }
 
 type SpatialReference struct {
-	Wkid       int64 `json:"wkid"`
-	LatestWkid int64 `json:"latestWkid"`
+	Wkid       int64  `json:"wkid,omitempty"`
+	LatestWkid int64  `json:"latestWkid,omitempty"`
+	Wkt        string `json:"wkt,omitempty"`
 }
 
 type Lod struct {
 	Level      int64   `json:"level"`
 	Resolution float64 `json:"resolution"`
-	Scale      int64   `json:"scale"`
+	Scale      float64 `json:"scale"`
 }
 
 type DocumentInfo struct {
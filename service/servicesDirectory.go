@@ -1,9 +1,9 @@
 package service
 
 type ServicesDirectory struct {
-	CurrentVersion float32       `json:"currentVersion"`
-	Folders        []interface{} `json:"folders"`
-	Services       []Service     `json:"services"`
+	CurrentVersion float32   `json:"currentVersion"`
+	Folders        []string  `json:"folders"`
+	Services       []Service `json:"services"`
 }
 
 type Service struct {
@@ -0,0 +1,15 @@
+package service
+
+type TileJSON struct {
+	TileJSON    string    `json:"tilejson"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Version     string    `json:"version"`
+	Attribution string    `json:"attribution,omitempty"`
+	Scheme      string    `json:"scheme"`
+	Tiles       []string  `json:"tiles"`
+	MinZoom     int64     `json:"minzoom"`
+	MaxZoom     int64     `json:"maxzoom"`
+	Bounds      []float64 `json:"bounds,omitempty"`
+	Center      []float64 `json:"center,omitempty"`
+}
@@ -0,0 +1,14 @@
+package service
+
+type TileMap struct {
+	Adjusted bool            `json:"adjusted"`
+	Location TileMapLocation `json:"location"`
+	Data     []int           `json:"data"`
+}
+
+type TileMapLocation struct {
+	Left   int64 `json:"left"`
+	Top    int64 `json:"top"`
+	Width  int64 `json:"width"`
+	Height int64 `json:"height"`
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"encoding/xml"
+)
+
+type TMSTileMap struct {
+	XMLName        xml.Name       `xml:"TileMap"`
+	Version        string         `xml:"version,attr"`
+	TileMapService string         `xml:"tilemapservice,attr"`
+	Title          string         `xml:"Title"`
+	Abstract       string         `xml:"Abstract"`
+	SRS            string         `xml:"SRS"`
+	BoundingBox    TMSBoundingBox `xml:"BoundingBox"`
+	Origin         TMSOrigin      `xml:"Origin"`
+	TileFormat     TMSTileFormat  `xml:"TileFormat"`
+	TileSets       TMSTileSets    `xml:"TileSets"`
+}
+
+type TMSBoundingBox struct {
+	MinX float64 `xml:"minx,attr"`
+	MinY float64 `xml:"miny,attr"`
+	MaxX float64 `xml:"maxx,attr"`
+	MaxY float64 `xml:"maxy,attr"`
+}
+
+type TMSOrigin struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type TMSTileFormat struct {
+	Width     int64  `xml:"width,attr"`
+	Height    int64  `xml:"height,attr"`
+	MimeType  string `xml:"mime-type,attr"`
+	Extension string `xml:"extension,attr"`
+}
+
+type TMSTileSets struct {
+	Profile  string       `xml:"profile,attr"`
+	TileSets []TMSTileSet `xml:"TileSet"`
+}
+
+type TMSTileSet struct {
+	Href          string  `xml:"href,attr"`
+	UnitsPerPixel float64 `xml:"units-per-pixel,attr"`
+	Order         int64   `xml:"order,attr"`
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/xml"
+)
+
+type WMSCapabilities struct {
+	XMLName        xml.Name
+	Version        string        `xml:"version,attr"`
+	Xmlns          string        `xml:"xmlns,attr,omitempty"`
+	XmlnsXlink     string        `xml:"xmlns:xlink,attr"`
+	XmlnsXsi       string        `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string        `xml:"xsi:schemaLocation,attr,omitempty"`
+	Service        WMSService    `xml:"Service"`
+	Capability     WMSCapability `xml:"Capability"`
+}
+
+type WMSService struct {
+	Name           string            `xml:"Name"`
+	Title          string            `xml:"Title"`
+	Abstract       string            `xml:"Abstract,omitempty"`
+	OnlineResource WMSOnlineResource `xml:"OnlineResource"`
+	MaxWidth       int64             `xml:"MaxWidth,omitempty"`
+	MaxHeight      int64             `xml:"MaxHeight,omitempty"`
+}
+
+type WMSOnlineResource struct {
+	Type string `xml:"xlink:type,attr"`
+	Href string `xml:"xlink:href,attr"`
+}
+
+type WMSCapability struct {
+	Request   WMSRequest `xml:"Request"`
+	Exception []string   `xml:"Exception>Format"`
+	Layer     WMSLayer   `xml:"Layer"`
+}
+
+type WMSRequest struct {
+	GetCapabilities WMSOperation `xml:"GetCapabilities"`
+	GetMap          WMSOperation `xml:"GetMap"`
+}
+
+type WMSOperation struct {
+	Formats        []string          `xml:"Format"`
+	OnlineResource WMSOnlineResource `xml:"DCPType>HTTP>Get>OnlineResource"`
+}
+
+type WMSLayer struct {
+	Queryable               int                       `xml:"queryable,attr"`
+	Opaque                  int                       `xml:"opaque,attr"`
+	Name                    string                    `xml:"Name,omitempty"`
+	Title                   string                    `xml:"Title"`
+	Abstract                string                    `xml:"Abstract,omitempty"`
+	CRS                     []string                  `xml:"CRS"`
+	SRS                     []string                  `xml:"SRS"`
+	EXGeographicBoundingBox *WMSGeographicBoundingBox `xml:"EX_GeographicBoundingBox,omitempty"`
+	LatLonBoundingBox       *WMSBoundingBox           `xml:"LatLonBoundingBox,omitempty"`
+	BoundingBoxes           []WMSBoundingBox          `xml:"BoundingBox"`
+	Layers                  []WMSLayer                `xml:"Layer"`
+}
+
+type WMSGeographicBoundingBox struct {
+	WestBoundLongitude float64 `xml:"westBoundLongitude"`
+	EastBoundLongitude float64 `xml:"eastBoundLongitude"`
+	SouthBoundLatitude float64 `xml:"southBoundLatitude"`
+	NorthBoundLatitude float64 `xml:"northBoundLatitude"`
+}
+
+type WMSBoundingBox struct {
+	CRS  string  `xml:"CRS,attr,omitempty"`
+	SRS  string  `xml:"SRS,attr,omitempty"`
+	MinX float64 `xml:"minx,attr"`
+	MinY float64 `xml:"miny,attr"`
+	MaxX float64 `xml:"maxx,attr"`
+	MaxY float64 `xml:"maxy,attr"`
+}
+
+type WMSServiceExceptionReport struct {
+	XMLName    xml.Name              `xml:"ServiceExceptionReport"`
+	Version    string                `xml:"version,attr"`
+	Xmlns      string                `xml:"xmlns,attr,omitempty"`
+	Exceptions []WMSServiceException `xml:"ServiceException"`
+}
+
+type WMSServiceException struct {
+	Code    string `xml:"code,attr,omitempty"`
+	Message string `xml:",chardata"`
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/xml"
+)
+
+type WMTSCapabilities struct {
+	XMLName               xml.Name                 `xml:"Capabilities"`
+	Xmlns                 string                   `xml:"xmlns,attr"`
+	XmlnsOws              string                   `xml:"xmlns:ows,attr"`
+	XmlnsXlink            string                   `xml:"xmlns:xlink,attr"`
+	XmlnsXsi              string                   `xml:"xmlns:xsi,attr"`
+	XmlnsGml              string                   `xml:"xmlns:gml,attr"`
+	SchemaLocation        string                   `xml:"xsi:schemaLocation,attr"`
+	Version               string                   `xml:"version,attr"`
+	ServiceIdentification OwsServiceIdentification `xml:"ows:ServiceIdentification"`
+	OperationsMetadata    OwsOperationsMetadata    `xml:"ows:OperationsMetadata"`
+	Contents              WMTSContents             `xml:"Contents"`
+	ServiceMetadataURL    XlinkHref                `xml:"ServiceMetadataURL"`
+}
+
+type OwsServiceIdentification struct {
+	Title              string `xml:"ows:Title"`
+	ServiceType        string `xml:"ows:ServiceType"`
+	ServiceTypeVersion string `xml:"ows:ServiceTypeVersion"`
+}
+
+type OwsOperationsMetadata struct {
+	Operations []OwsOperation `xml:"ows:Operation"`
+}
+
+type OwsOperation struct {
+	Name string   `xml:"name,attr"`
+	Gets []OwsGet `xml:"ows:DCP>ows:HTTP>ows:Get"`
+}
+
+type OwsGet struct {
+	Href       string        `xml:"xlink:href,attr"`
+	Constraint OwsConstraint `xml:"ows:Constraint"`
+}
+
+type OwsConstraint struct {
+	Name          string   `xml:"name,attr"`
+	AllowedValues []string `xml:"ows:AllowedValues>ows:Value"`
+}
+
+type XlinkHref struct {
+	Href string `xml:"xlink:href,attr"`
+}
+
+type WMTSContents struct {
+	Layers         []WMTSLayer         `xml:"Layer"`
+	TileMatrixSets []WMTSTileMatrixSet `xml:"TileMatrixSet"`
+}
+
+type WMTSLayer struct {
+	Title             string                  `xml:"ows:Title"`
+	Identifier        string                  `xml:"ows:Identifier"`
+	BoundingBox       *OwsBoundingBox         `xml:"ows:BoundingBox,omitempty"`
+	WGS84BoundingBox  *OwsBoundingBox         `xml:"ows:WGS84BoundingBox,omitempty"`
+	Style             WMTSStyle               `xml:"Style"`
+	Format            string                  `xml:"Format"`
+	TileMatrixSetLink []WMTSTileMatrixSetLink `xml:"TileMatrixSetLink"`
+	ResourceURL       *WMTSResourceURL        `xml:"ResourceURL,omitempty"`
+}
+
+type OwsBoundingBox struct {
+	Crs         string `xml:"crs,attr,omitempty"`
+	LowerCorner string `xml:"ows:LowerCorner"`
+	UpperCorner string `xml:"ows:UpperCorner"`
+}
+
+type WMTSStyle struct {
+	IsDefault  bool   `xml:"isDefault,attr"`
+	Title      string `xml:"ows:Title"`
+	Identifier string `xml:"ows:Identifier"`
+}
+
+type WMTSTileMatrixSetLink struct {
+	TileMatrixSet string `xml:"TileMatrixSet"`
+}
+
+type WMTSResourceURL struct {
+	Format       string `xml:"format,attr"`
+	ResourceType string `xml:"resourceType,attr"`
+	Template     string `xml:"template,attr"`
+}
+
+type WMTSTileMatrixSet struct {
+	Title        string           `xml:"ows:Title"`
+	Identifier   string           `xml:"ows:Identifier"`
+	SupportedCRS string           `xml:"ows:SupportedCRS"`
+	TileMatrixes []WMTSTileMatrix `xml:"TileMatrix"`
+}
+
+type WMTSTileMatrix struct {
+	Identifier       string  `xml:"ows:Identifier"`
+	ScaleDenominator float64 `xml:"ScaleDenominator"`
+	TopLeftCorner    string  `xml:"TopLeftCorner"`
+	TileWidth        int64   `xml:"TileWidth"`
+	TileHeight       int64   `xml:"TileHeight"`
+	MatrixWidth      int64   `xml:"MatrixWidth"`
+	MatrixHeight     int64   `xml:"MatrixHeight"`
+}
+
+type OwsExceptionReport struct {
+	XMLName   xml.Name     `xml:"ows:ExceptionReport"`
+	XmlnsOws  string       `xml:"xmlns:ows,attr"`
+	Version   string       `xml:"version,attr"`
+	Lang      string       `xml:"xml:lang,attr"`
+	Exception OwsException `xml:"ows:Exception"`
+}
+
+type OwsException struct {
+	ExceptionCode string `xml:"exceptionCode,attr"`
+	Locator       string `xml:"locator,attr,omitempty"`
+	ExceptionText string `xml:"ows:ExceptionText"`
+}
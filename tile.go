@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisxiaowei/basemapServer/config"
+	"github.com/gisxiaowei/basemapServer/dataSource/arcgisCache"
+)
+
+var (
+	ErrUnsupportMissingTile = errors.New("不支持的缺失切片处理方式")
+)
+
+// 缺失切片处理策略
+type missingTilePolicy struct {
+	Mode        string
+	Image       []byte
+	ContentType string
+}
+
+// 透明PNG缓存，键为“宽x高”
+var blankTiles = struct {
+	sync.Mutex
+	m map[string][]byte
+}{m: make(map[string][]byte)}
+
+// 获取切片及其所在bundle的修改时间，优先从切片缓存中读取，未命中时才读取修改时间
+func (s *serviceEntry) getTileBytes(level int64, row int64, col int64) ([]byte, time.Time, error) {
+	var getTileBytes func(int64, int64, int64) ([]byte, error)
+	var getTileModTime func(int64, int64, int64) (time.Time, error)
+	if s.VectorTile != nil {
+		getTileBytes, getTileModTime = s.VectorTile.GetTileBytes, s.VectorTile.GetTileModTime
+	} else {
+		getTileBytes, getTileModTime = s.ArcgisCache.GetTileBytes, s.ArcgisCache.GetTileModTime
+	}
+
+	key := tileKey{serviceID: s.id, level: level, row: row, col: col}
+	if !s.Config.DisableTileCache {
+		if data, modTime, ok := tileCache.get(key); ok {
+			return data, modTime, nil
+		}
+	}
+	data, err := getTileBytes(level, row, col)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	modTime, err := getTileModTime(level, row, col)
+	if err != nil {
+		modTime = time.Time{}
+	}
+	if !s.Config.DisableTileCache {
+		tileCache.add(key, data, modTime)
+	}
+	return data, modTime, nil
+}
+
+// 获取转换格式后的切片，优先从切片缓存中读取
+func (s *serviceEntry) getTranscodedTile(level int64, row int64, col int64, data []byte, modTime time.Time, format string, quality int) ([]byte, error) {
+	if s.Config.DisableTileCache {
+		return arcgisCache.TranscodeTile(data, format, quality)
+	}
+
+	key := tileKey{serviceID: s.id, level: level, row: row, col: col, format: format, quality: quality}
+	if transcoded, _, ok := tileCache.get(key); ok {
+		return transcoded, nil
+	}
+	transcoded, err := arcgisCache.TranscodeTile(data, format, quality)
+	if err != nil {
+		return nil, err
+	}
+	tileCache.add(key, transcoded, modTime)
+	return transcoded, nil
+}
+
+// 输出切片，设置ETag、Last-Modified和Cache-Control，并处理条件请求。
+// 请求要求的格式与切片格式不同时转换格式，转换失败时输出原切片
+func writeTile(w http.ResponseWriter, r *http.Request, s *serviceEntry, level int64, row int64, col int64, data []byte, modTime time.Time) {
+	header := w.Header()
+	header.Add("Vary", "Accept")
+
+	// 切片实际格式以文件头为准
+	tileFormat := arcgisCache.DetectTileFormat(data)
+	if tileFormat == "" {
+		tileFormat = s.ArcgisCache.GetTileFormat()
+	}
+	if format, quality := getRequestTileFormat(r, tileFormat); format != "" {
+		transcoded, err := s.getTranscodedTile(level, row, col, data, modTime, format, quality)
+		if err != nil {
+			log.Println(err)
+		} else {
+			data, tileFormat = transcoded, format
+		}
+	}
+	header.Set("Content-Type", "image/"+tileFormat)
+	setTileCacheHeaders(header, s, data)
+
+	// Last-Modified取bundle文件的修改时间，ServeContent处理If-None-Match、If-Modified-Since并返回304
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
+
+// 设置切片的ETag（切片内容的哈希值）和Cache-Control
+func setTileCacheHeaders(header http.Header, s *serviceEntry, data []byte) {
+	h := fnv.New64a()
+	h.Write(data)
+	header.Set("ETag", fmt.Sprintf(`"%x"`, h.Sum64()))
+
+	if s.Config.CacheControl != "" {
+		header.Set("Cache-Control", s.Config.CacheControl)
+	} else if s.Config.MaxAge > 0 {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", s.Config.MaxAge))
+	}
+}
+
+// 获取请求要求的切片格式和JPEG质量，不需转换时格式为空。参数format（如webp、jpeg、png、image/webp）优先，
+// 其次为Accept中不接受切片原格式时选择可接受的格式
+func getRequestTileFormat(r *http.Request, tileFormat string) (string, int) {
+	query := r.URL.Query()
+	quality, _ := strconv.Atoi(query.Get("quality"))
+
+	format := ""
+	if value := strings.TrimSpace(query.Get("format")); value != "" {
+		value = strings.TrimPrefix(strings.ToLower(value), "image/")
+		switch {
+		case strings.HasPrefix(value, "png"):
+			format = arcgisCache.TileFormatPNG
+		case value == "jpg" || value == "jpeg":
+			format = arcgisCache.TileFormatJPEG
+		case value == "webp":
+			format = arcgisCache.TileFormatWebP
+		}
+	} else if accept := r.Header.Get("Accept"); accept != "" {
+		format = negotiateTileFormat(accept, tileFormat)
+	}
+
+	requestedQuality := quality > 0 && quality <= 100
+	if format != arcgisCache.TileFormatJPEG {
+		quality = 0
+	} else if !requestedQuality {
+		quality = jpeg.DefaultQuality
+	}
+	// 与切片格式相同时不需转换，JPEG切片请求了质量时按该质量重新编码
+	if format == tileFormat && !(format == arcgisCache.TileFormatJPEG && requestedQuality) {
+		return "", 0
+	}
+	return format, quality
+}
+
+// 根据Accept选择切片格式，接受原格式或都不接受时返回原格式
+func negotiateTileFormat(accept string, tileFormat string) string {
+	// 媒体类型及其q值
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[mediaType] = q
+	}
+	getQuality := func(format string) float64 {
+		for _, mediaType := range []string{"image/" + format, "image/*", "*/*"} {
+			if q, ok := qualities[mediaType]; ok {
+				return q
+			}
+		}
+		return 0
+	}
+
+	if getQuality(tileFormat) > 0 {
+		return tileFormat
+	}
+	format, best := tileFormat, 0.0
+	for _, candidate := range []string{arcgisCache.TileFormatWebP, arcgisCache.TileFormatPNG, arcgisCache.TileFormatJPEG} {
+		if q := getQuality(candidate); q > best {
+			format, best = candidate, q
+		}
+	}
+	return format
+}
+
+// 根据服务配置创建缺失切片处理策略
+func newMissingTilePolicy(s config.Service) (missingTilePolicy, error) {
+	policy := missingTilePolicy{Mode: strings.ToLower(strings.TrimSpace(s.MissingTile))}
+	switch policy.Mode {
+	case "", config.MissingTileNotFound:
+		policy.Mode = config.MissingTileNotFound
+	case config.MissingTileBlank:
+	case config.MissingTilePlaceholder:
+		image, err := ioutil.ReadFile(s.PlaceholderImage)
+		if err != nil {
+			return policy, err
+		}
+		policy.Image = image
+		policy.ContentType = mime.TypeByExtension(filepath.Ext(s.PlaceholderImage))
+		if policy.ContentType == "" {
+			policy.ContentType = "image/png"
+		}
+	default:
+		return policy, ErrUnsupportMissingTile
+	}
+	return policy, nil
+}
+
+// 是否为切片缺失的错误
+func isMissingTileError(err error) bool {
+	switch err {
+	case arcgisCache.ErrTileNotFound, arcgisCache.ErrBundleNotFound, arcgisCache.ErrLevelOutOfRange, arcgisCache.ErrInvalidLevelRowCol:
+		return true
+	}
+	return false
+}
+
+// 获取缺失切片的替代图片，策略为404时返回false
+func getMissingTile(s *serviceEntry) ([]byte, string, bool) {
+	policy := s.MissingTilePolicy
+	switch policy.Mode {
+	case config.MissingTileBlank:
+		tileCacheInfo := s.ArcgisCache.GetCacheInfo().TileCacheInfo
+		blank, err := getBlankTile(tileCacheInfo.TileCols, tileCacheInfo.TileRows)
+		if err != nil {
+			return nil, "", false
+		}
+		return blank, "image/png", true
+	case config.MissingTilePlaceholder:
+		return policy.Image, policy.ContentType, true
+	}
+	return nil, "", false
+}
+
+// 获取指定大小的透明PNG
+func getBlankTile(width int64, height int64) ([]byte, error) {
+	key := fmt.Sprintf("%dx%d", width, height)
+
+	blankTiles.Lock()
+	defer blankTiles.Unlock()
+	if blank, ok := blankTiles.m[key]; ok {
+		return blank, nil
+	}
+
+	var buf bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	blankTiles.m[key] = buf.Bytes()
+	return buf.Bytes(), nil
+}
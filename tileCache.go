@@ -0,0 +1,171 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 每个缓存项除切片数据外的估算开销（字节）
+const tileCacheEntryOverhead = 64
+
+// 全局切片缓存
+var tileCache = newTileLRU(0)
+
+// tileKey 切片缓存键，serviceID为服务加载时分配的编号，服务重新加载后旧的缓存项不会再命中；
+// format、quality为转换后的格式和JPEG质量，原始切片为空
+type tileKey struct {
+	serviceID uint64
+	level     int64
+	row       int64
+	col       int64
+	format    string
+	quality   int
+}
+
+type tileLRUEntry struct {
+	key     tileKey
+	data    []byte
+	modTime time.Time // 切片所在bundle的修改时间，用于Last-Modified
+}
+
+// tileLRU 按字节数限制大小的LRU切片缓存
+type tileLRU struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[tileKey]*list.Element
+	retired  map[uint64]bool // 已移除但仍有请求在使用的服务编号，不再写入其切片
+
+	hits   int64
+	misses int64
+}
+
+// TileCacheStats 切片缓存统计信息
+type TileCacheStats struct {
+	MaxBytes int64 `json:"maxBytes"`
+	Bytes    int64 `json:"bytes"`
+	Entries  int   `json:"entries"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+// 创建切片缓存，maxBytes为0时不缓存
+func newTileLRU(maxBytes int64) *tileLRU {
+	return &tileLRU{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[tileKey]*list.Element),
+		retired:  make(map[uint64]bool),
+	}
+}
+
+// 获取切片及其修改时间
+func (c *tileLRU) get(key tileKey) ([]byte, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		c.hits++
+		entry := e.Value.(*tileLRUEntry)
+		return entry.data, entry.modTime, true
+	}
+	c.misses++
+	return nil, time.Time{}, false
+}
+
+// 添加切片，超出容量时淘汰最久未使用的切片。服务已移除时不添加，
+// 与purge在同一把锁下判断，避免移除后仍在读取的请求写入切片
+func (c *tileLRU) add(key tileKey, data []byte, modTime time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.retired[key.serviceID] {
+		return
+	}
+
+	size := int64(len(data)) + tileCacheEntryOverhead
+	if size > c.maxBytes {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		entry := e.Value.(*tileLRUEntry)
+		c.bytes += int64(len(data)) - int64(len(entry.data))
+		entry.data = data
+		entry.modTime = modTime
+	} else {
+		c.items[key] = c.ll.PushFront(&tileLRUEntry{key: key, data: data, modTime: modTime})
+		c.bytes += size
+	}
+	c.evict()
+}
+
+// 删除服务的全部切片，并记录服务已移除，之后不再添加其切片
+func (c *tileLRU) purge(serviceID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retired[serviceID] = true
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*tileLRUEntry).key.serviceID == serviceID {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// 删除服务的移除记录，服务关闭后已没有请求会添加其切片，不再需要记录
+func (c *tileLRU) forget(serviceID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.retired, serviceID)
+}
+
+// 清空缓存
+func (c *tileLRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[tileKey]*list.Element)
+	c.bytes = 0
+}
+
+// 修改容量
+func (c *tileLRU) setMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// 获取统计信息
+func (c *tileLRU) stats() TileCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return TileCacheStats{
+		MaxBytes: c.maxBytes,
+		Bytes:    c.bytes,
+		Entries:  c.ll.Len(),
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+}
+
+// 淘汰切片直到不超出容量
+func (c *tileLRU) evict() {
+	for c.bytes > c.maxBytes {
+		e := c.ll.Back()
+		if e == nil {
+			return
+		}
+		c.remove(e)
+	}
+}
+
+func (c *tileLRU) remove(e *list.Element) {
+	entry := c.ll.Remove(e).(*tileLRUEntry)
+	delete(c.items, entry.key)
+	c.bytes -= int64(len(entry.data)) + tileCacheEntryOverhead
+}
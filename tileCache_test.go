@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 缓存项占用的字节数
+func tileEntrySize(data string) int64 {
+	return int64(len(data)) + tileCacheEntryOverhead
+}
+
+func TestTileLRU(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newTileLRU(3 * tileEntrySize("0123456789"))
+	key := func(serviceID uint64, col int64) tileKey {
+		return tileKey{serviceID: serviceID, col: col}
+	}
+
+	c.add(key(1, 0), []byte("0123456789"), modTime)
+	c.add(key(1, 1), []byte("0123456789"), modTime)
+	c.add(key(2, 0), []byte("01234"), modTime)
+	if data, gotModTime, ok := c.get(key(1, 0)); !ok || string(data) != "0123456789" || !gotModTime.Equal(modTime) {
+		t.Errorf("获取切片为%q、%v、%v", data, gotModTime, ok)
+	}
+	if stats := c.stats(); stats.Bytes != 2*tileEntrySize("0123456789")+tileEntrySize("01234") || stats.Entries != 3 {
+		t.Errorf("缓存%d字节、%d项", stats.Bytes, stats.Entries)
+	}
+
+	// 替换切片时按新旧数据长度之差计算
+	c.add(key(2, 0), []byte("0123456789"), modTime)
+	if stats := c.stats(); stats.Bytes != 3*tileEntrySize("0123456789") || stats.Entries != 3 {
+		t.Errorf("替换后缓存%d字节、%d项", stats.Bytes, stats.Entries)
+	}
+
+	// 超出容量时淘汰最久未使用的切片
+	c.add(key(2, 1), []byte("0123456789"), modTime)
+	if _, _, ok := c.get(key(1, 1)); ok {
+		t.Error("没有淘汰最久未使用的切片")
+	}
+	if _, _, ok := c.get(key(1, 0)); !ok {
+		t.Error("淘汰了最近使用的切片")
+	}
+
+	// 超出容量的切片不缓存
+	c.add(key(3, 0), make([]byte, c.maxBytes), modTime)
+	if _, _, ok := c.get(key(3, 0)); ok {
+		t.Error("缓存了超出容量的切片")
+	}
+
+	// 缩小容量
+	c.setMaxBytes(tileEntrySize("0123456789"))
+	if stats := c.stats(); stats.Bytes != tileEntrySize("0123456789") || stats.Entries != 1 {
+		t.Errorf("缩小容量后缓存%d字节、%d项", stats.Bytes, stats.Entries)
+	}
+
+	stats := c.stats()
+	if stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("命中%d次、未命中%d次，期望2次、2次", stats.Hits, stats.Misses)
+	}
+}
+
+func TestTileLRURetired(t *testing.T) {
+	c := newTileLRU(1 << 20)
+	c.add(tileKey{serviceID: 1}, []byte("a"), time.Time{})
+	c.add(tileKey{serviceID: 1, col: 1}, []byte("b"), time.Time{})
+	c.add(tileKey{serviceID: 2}, []byte("c"), time.Time{})
+
+	// 移除服务时删除其切片，之后不再添加
+	c.purge(1)
+	if stats := c.stats(); stats.Entries != 1 || stats.Bytes != tileEntrySize("c") {
+		t.Errorf("移除服务后缓存%d字节、%d项", stats.Bytes, stats.Entries)
+	}
+	c.add(tileKey{serviceID: 1}, []byte("a"), time.Time{})
+	if _, _, ok := c.get(tileKey{serviceID: 1}); ok {
+		t.Error("已移除的服务添加了切片")
+	}
+
+	// 服务关闭后删除移除记录
+	c.forget(1)
+	if len(c.retired) != 0 {
+		t.Errorf("服务关闭后还有%d条移除记录", len(c.retired))
+	}
+
+	// 清空缓存
+	c.clear()
+	if stats := c.stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("清空后缓存%d字节、%d项", stats.Bytes, stats.Entries)
+	}
+}